@@ -0,0 +1,269 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// 节点间调用的协议版本, 接收方版本不一致时拒绝请求, 避免滚动升级期间按错误的格式解析
+const (
+	RpcVersion       = "1"
+	RpcVersionHeader = "X-Wsystemd-Rpc"
+)
+
+const (
+	defaultRpcTimeout       = 10
+	defaultRpcSubmitTimeout = 30 // 创建任务及接管任务需要启动进程
+	defaultRpcRetries       = 2
+	rpcRetryInterval        = 200 * time.Millisecond
+)
+
+var ErrWorkerNotFound = errors.New("worker not found")
+
+// RpcConfig 节点间调用配置, 单位秒
+type RpcConfig struct {
+	Timeout       int `mapstructure:"timeout"`
+	SubmitTimeout int `mapstructure:"submittimeout"`
+	// 幂等接口在网络错误或 5xx 时的重试次数
+	Retries int `mapstructure:"retries"`
+	// 节点间请求的签名密钥, 集群内所有节点需一致
+	Secret string `mapstructure:"secret"`
+	// 签名时间戳允许的最大偏差
+	MaxSkew int `mapstructure:"maxskew"`
+}
+
+var (
+	rpcConfig         *RpcConfig
+	rpcConfigOnce     sync.Once
+	rpcHttpClient     *http.Client
+	rpcHttpClientOnce sync.Once
+	rpcScheme         = "http"
+)
+
+// httpClient 服务端开启 TLS 时节点间调用使用 https, 并出示本节点证书
+func httpClient() *http.Client {
+	rpcHttpClientOnce.Do(func() {
+		rpcHttpClient = &http.Client{}
+		conf := core.GetTLSConfig()
+		if !conf.Enabled() {
+			return
+		}
+		rpcScheme = "https"
+		tlsConfig, err := conf.ClientConfig()
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "Load rpc tls config err", "err", err)
+			return
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		rpcHttpClient.Transport = transport
+	})
+	return rpcHttpClient
+}
+
+func GetRpcConfig() *RpcConfig {
+	rpcConfigOnce.Do(func() {
+		rpcConfig = &RpcConfig{}
+		if conf, err := core.GetSingleConfig(core.CoreConfig, "rpc", RpcConfig{}); err == nil {
+			rpcConfig = conf.(*RpcConfig)
+		}
+		if rpcConfig.Timeout <= 0 {
+			rpcConfig.Timeout = defaultRpcTimeout
+		}
+		if rpcConfig.SubmitTimeout <= 0 {
+			rpcConfig.SubmitTimeout = defaultRpcSubmitTimeout
+		}
+		if rpcConfig.MaxSkew <= 0 {
+			rpcConfig.MaxSkew = defaultRpcMaxSkew
+		}
+		if rpcConfig.Retries < 0 {
+			rpcConfig.Retries = 0
+		} else if rpcConfig.Retries == 0 {
+			rpcConfig.Retries = defaultRpcRetries
+		}
+	})
+	return rpcConfig
+}
+
+// RemoteError 远端接口返回的业务错误
+type RemoteError struct {
+	Code *utils.CodeType
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error: code=%d message=%s", e.Code.Code, e.Code.Msg)
+}
+
+// CodeOf 将调用错误转换为返回给客户端的错误码, 远端业务错误原样透传
+func CodeOf(err error) *utils.CodeType {
+	var remote *RemoteError
+	switch {
+	case err == nil:
+		return &utils.CodeType{}
+	case errors.As(err, &remote):
+		return remote.Code
+	case errors.Is(err, ErrWorkerNotFound), errors.Is(err, ErrViewNotSynced):
+		return utils.ServerNotExist
+	case errors.Is(err, context.DeadlineExceeded):
+		return utils.WorkerTimeout
+	}
+	return utils.ServerErr
+}
+
+// WorkerClient 调用其他节点的接口
+type WorkerClient struct {
+	worker *Worker
+	conf   *RpcConfig
+	local  string
+}
+
+func NewWorkerClient(worker *Worker) *WorkerClient {
+	local, _ := process.GetHostName()
+	return &WorkerClient{worker: worker, conf: GetRpcConfig(), local: local}
+}
+
+// ClientFor 按主机名获取存活节点的客户端
+func ClientFor(node string) (*WorkerClient, error) {
+	worker, err := GetWorkerInfo(node)
+	if err != nil {
+		return nil, err
+	}
+	return NewWorkerClient(worker), nil
+}
+
+// Submit 在目标节点创建任务, 非幂等不重试
+func (c *WorkerClient) Submit(ctx context.Context, req params.JobCfg) (interface{}, error) {
+	return c.call(ctx, http.MethodPost, "/v1/jobs/submit", nil, req, c.conf.SubmitTimeout, false)
+}
+
+func (c *WorkerClient) Stop(ctx context.Context, jobId string) error {
+	_, err := c.call(ctx, http.MethodPut, "/v1/jobs/"+url.PathEscape(jobId)+"/stop", nil, nil, c.conf.Timeout, true)
+	return err
+}
+
+func (c *WorkerClient) StopBigOne(ctx context.Context, req params.BigOne) error {
+	_, err := c.call(ctx, http.MethodPost, "/v1/jobs/stopBigOne", nil, req, c.conf.Timeout, true)
+	return err
+}
+
+// Report 心跳上报, 参数通过 query 传递
+func (c *WorkerClient) Report(ctx context.Context, req params.JobReporter) error {
+	query := url.Values{"token": {req.Token}, "pid": {req.Pid}}
+	_, err := c.call(ctx, http.MethodPost, "/v1/agent/tasks/report", query, nil, c.conf.Timeout, true)
+	return err
+}
+
+func (c *WorkerClient) Info(ctx context.Context, req params.JobInfo) (interface{}, error) {
+	return c.call(ctx, http.MethodPost, "/v1/job/info", nil, req, c.conf.Timeout, true)
+}
+
+// Adopt 在目标节点拉起已分配给它的任务, 已在运行时直接返回
+func (c *WorkerClient) Adopt(ctx context.Context, jobId string) error {
+	_, err := c.call(ctx, http.MethodPost, "/v1/jobs/"+url.PathEscape(jobId)+"/adopt", nil, nil, c.conf.SubmitTimeout, true)
+	return err
+}
+
+// Release 停止目标节点上已迁出的任务进程
+func (c *WorkerClient) Release(ctx context.Context, jobId string) error {
+	_, err := c.call(ctx, http.MethodPost, "/v1/jobs/"+url.PathEscape(jobId)+"/release", nil, nil, c.conf.Timeout, true)
+	return err
+}
+
+// SetState 修改目标节点状态, action 为 cordon/uncordon/drain
+func (c *WorkerClient) SetState(ctx context.Context, action string) (interface{}, error) {
+	return c.call(ctx, http.MethodPost, "/v1/workers/"+url.PathEscape(c.worker.Hostname)+"/"+action, nil, nil, c.conf.Timeout, true)
+}
+
+// call ctx 没有截止时间时使用 timeout, 幂等接口在网络错误或 5xx 时重试, 远端业务错误不重试
+func (c *WorkerClient) call(ctx context.Context, method, path string, query url.Values, body interface{}, timeout int, idempotent bool) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	client := httpClient()
+	target := fmt.Sprintf("%s://%s:%s%s", rpcScheme, c.worker.IP, c.worker.Port, path)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += c.conf.Retries
+	}
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, lastErr
+			case <-time.After(rpcRetryInterval * time.Duration(i)):
+			}
+		}
+		data, retry, err := c.do(ctx, client, method, target, payload)
+		if err == nil || !retry {
+			return data, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (c *WorkerClient) do(ctx context.Context, client *http.Client, method, target string, payload []byte) (interface{}, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RpcVersionHeader, RpcVersion)
+	SignRequest(req, payload, c.local, c.conf.Secret)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, true, fmt.Errorf("%s %s: http status %d", method, target, resp.StatusCode)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("%s %s: http status %d", method, target, resp.StatusCode)
+	}
+
+	var result utils.RepType
+	if err = json.Unmarshal(raw, &result); err != nil {
+		return nil, false, fmt.Errorf("%s %s: decode response: %v", method, target, err)
+	}
+	if result.Code != utils.SUCCESS.Code {
+		return nil, false, &RemoteError{Code: &utils.CodeType{Code: result.Code, Msg: result.Msg}}
+	}
+	return result.Data, false, nil
+}
@@ -1,55 +1,29 @@
 package cluster
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"time"
-	"wsystemd/cmd/http/core"
-	"wsystemd/cmd/utils"
-
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func GetEtcdAddr() string {
-	if core.CoreConfig["etcd"].(string) == "" {
-		return ""
-	}
-	return core.CoreConfig["etcd"].(string) + ":2379"
-}
-
+// GetEtcdClient 按配置创建新的 etcd 客户端, 调用方负责关闭
 func GetEtcdClient() (*clientv3.Client, error) {
-	return clientv3.New(clientv3.Config{
-		Endpoints:   []string{GetEtcdAddr()},
-		DialTimeout: 5 * time.Second,
-	})
-}
-
-func GetWorkerInfo(nodeName string) (*Worker, error) {
-	cli, err := GetEtcdClient()
-	if err != nil {
-		return nil, err
-	}
-	defer cli.Close()
-
-	resp, err := cli.Get(context.Background(), fmt.Sprintf("/workers/%s", nodeName))
+	conf, err := GetEtcdConfig()
 	if err != nil {
 		return nil, err
 	}
+	return conf.NewClient()
+}
 
-	if len(resp.Kvs) == 0 {
-		return nil, fmt.Errorf("worker not found")
+// GetWorkerInfo 按主机名从集群缓存中查找存活节点
+func GetWorkerInfo(nodeName string) (*Worker, error) {
+	if WkMg == nil {
+		return nil, ErrViewNotSynced
 	}
-
-	var worker Worker
-	if err := json.Unmarshal(resp.Kvs[0].Value, &worker); err != nil {
+	if _, err := WkMg.view.Workers(); err != nil {
 		return nil, err
 	}
-
+	worker, ok := WkMg.view.Get(nodeName)
+	if !ok {
+		return nil, ErrWorkerNotFound
+	}
 	return &worker, nil
 }
-
-func ForwardToWorker(worker *Worker, path string, body interface{}) (interface{}, error) {
-	targetURL := fmt.Sprintf("http://%s:%s%s", worker.IP, worker.Port, path)
-	return utils.ForwardRequest(targetURL, body)
-}
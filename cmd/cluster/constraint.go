@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/process"
+)
+
+func init() {
+	RegisterFilter(constraintFilter{})
+}
+
+// LocalWorker 本机节点信息, dc/labels 读取配置, 不包含资源使用情况
+func LocalWorker() (Worker, error) {
+	hostname, err := process.GetHostName()
+	if err != nil {
+		return Worker{}, err
+	}
+	ipSet, err := process.GetServerIpV6()
+	if err != nil {
+		return Worker{}, err
+	}
+	ips := make([]string, 0, len(ipSet))
+	for ip := range ipSet {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	w := Worker{
+		Hostname: hostname,
+		Port:     consts.ServerPort,
+		IPs:      ips,
+		Labels:   make(map[string]string),
+	}
+	if len(ips) > 0 {
+		w.IP = ips[0]
+	}
+	if dc, ok := core.CoreConfig["dc"].(string); ok {
+		w.Dc = dc
+	}
+	if labels, ok := core.CoreConfig["labels"].(map[string]interface{}); ok {
+		for k, v := range labels {
+			w.Labels[strings.ToLower(k)] = fmt.Sprint(v)
+		}
+	}
+	return w, nil
+}
+
+// HasConstraints 请求是否指定了放置约束
+func (req *ScheduleRequest) HasConstraints() bool {
+	return req.Node != "" || req.Dc != "" || req.Ip != "" || len(req.Selector) > 0
+}
+
+// MatchConstraints node/dc/ip/selector 均为硬约束, 不满足时返回原因, 标签 key 不区分大小写
+func MatchConstraints(req *ScheduleRequest, w *Worker) error {
+	if req.Node != "" && req.Node != w.Hostname {
+		return fmt.Errorf("node %s not match", w.Hostname)
+	}
+	if req.Dc != "" && req.Dc != w.Dc {
+		return fmt.Errorf("dc %q not match %q", w.Dc, req.Dc)
+	}
+	if req.Ip != "" && !w.HasIP(req.Ip) {
+		return fmt.Errorf("ip %s not found", req.Ip)
+	}
+	for k, v := range req.Selector {
+		if label := w.Labels[strings.ToLower(k)]; label != v {
+			return fmt.Errorf("label %s=%q not match %q", k, label, v)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) HasIP(ip string) bool {
+	if w.IP == ip {
+		return true
+	}
+	for _, v := range w.IPs {
+		if v == ip {
+			return true
+		}
+	}
+	return false
+}
+
+type constraintFilter struct{}
+
+func (constraintFilter) Name() string { return "constraint" }
+
+func (constraintFilter) Filter(req *ScheduleRequest, w *Worker) error {
+	return MatchConstraints(req, w)
+}
@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"wsystemd/cmd/http/core"
+
+	"github.com/goinggo/mapstructure"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+const (
+	defaultEtcdPort           = "2379"
+	defaultDialTimeout        = 5
+	defaultEtcdRequestTimeout = 5
+)
+
+// EtcdConfig etcd 连接配置, 兼容旧版的单个地址或地址列表写法
+type EtcdConfig struct {
+	Endpoints []string `mapstructure:"endpoints"`
+	Username  string   `mapstructure:"username"`
+	Password  string   `mapstructure:"password"`
+	// mTLS 客户端证书, 只配置 caFile 时使用单向 TLS
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+	CaFile   string `mapstructure:"cafile"`
+	// 所有 key 的前缀, 多个 wsystemd 集群共用一套 etcd 时用于隔离
+	Prefix string `mapstructure:"prefix"`
+	// 单位秒
+	DialTimeout    int `mapstructure:"dialtimeout"`
+	RequestTimeout int `mapstructure:"requesttimeout"`
+}
+
+// GetEtcdConfig 读取配置中的 etcd 段
+func GetEtcdConfig() (*EtcdConfig, error) {
+	return ParseEtcdConfig(core.CoreConfig["etcd"])
+}
+
+// ParseEtcdConfig 支持三种写法: 单个地址字符串、地址列表、完整配置
+// 地址不带端口时默认 2379
+func ParseEtcdConfig(raw interface{}) (*EtcdConfig, error) {
+	conf := &EtcdConfig{}
+	switch v := raw.(type) {
+	case nil:
+	case string:
+		if v != "" {
+			conf.Endpoints = []string{v}
+		}
+	case []interface{}:
+		for _, endpoint := range v {
+			conf.Endpoints = append(conf.Endpoints, fmt.Sprint(endpoint))
+		}
+	case []string:
+		conf.Endpoints = v
+	case map[string]interface{}:
+		if err := mapstructure.Decode(v, conf); err != nil {
+			return nil, fmt.Errorf("invalid etcd config: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid etcd config type %T", raw)
+	}
+
+	endpoints := make([]string, 0, len(conf.Endpoints))
+	for _, endpoint := range conf.Endpoints {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		endpoints = append(endpoints, withDefaultPort(endpoint))
+	}
+	conf.Endpoints = endpoints
+	if len(conf.Endpoints) == 0 {
+		return nil, errors.New("etcd endpoints is empty")
+	}
+
+	if conf.Prefix != "" {
+		conf.Prefix = "/" + strings.Trim(conf.Prefix, "/")
+	}
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = defaultDialTimeout
+	}
+	if conf.RequestTimeout <= 0 {
+		conf.RequestTimeout = defaultEtcdRequestTimeout
+	}
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return nil, errors.New("etcd certFile and keyFile must be set together")
+	}
+	return conf, nil
+}
+
+func withDefaultPort(endpoint string) string {
+	scheme := ""
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		scheme, endpoint = endpoint[:i+3], endpoint[i+3:]
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(strings.Trim(endpoint, "[]"), defaultEtcdPort)
+	}
+	return scheme + endpoint
+}
+
+func (c *EtcdConfig) tlsConfig() (*tls.Config, error) {
+	if c.CertFile == "" && c.CaFile == "" {
+		return nil, nil
+	}
+	info := transport.TLSInfo{
+		CertFile:      c.CertFile,
+		KeyFile:       c.KeyFile,
+		TrustedCAFile: c.CaFile,
+	}
+	return info.ClientConfig()
+}
+
+// NewClient 创建 etcd 客户端, 配置了 prefix 时 KV/Watch/Lease 均在前缀下操作
+func (c *EtcdConfig) NewClient() (*clientv3.Client, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load etcd tls config: %v", err)
+	}
+
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   c.Endpoints,
+		Username:    c.Username,
+		Password:    c.Password,
+		TLS:         tlsConfig,
+		DialTimeout: time.Duration(c.DialTimeout) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Prefix != "" {
+		cli.KV = namespace.NewKV(cli.KV, c.Prefix)
+		cli.Watcher = namespace.NewWatcher(cli.Watcher, c.Prefix)
+		cli.Lease = namespace.NewLease(cli.Lease, c.Prefix)
+	}
+	return cli, nil
+}
+
+// WithTimeout 单次 etcd 请求的超时 context, Watch/KeepAlive 等长连接不使用
+func (c *EtcdConfig) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(c.RequestTimeout)*time.Second)
+}
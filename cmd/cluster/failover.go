@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/log"
+
+	"github.com/go-kit/kit/log/level"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const (
+	lockPrefix = "/lock/"
+
+	defaultFailoverDelay = 30
+)
+
+// FailoverDelay 节点下线后等待多久再转移任务, 配置 failoverDelay(秒)
+// 节点重启期间会短暂下线, 在此期间恢复的节点自行接管任务
+func FailoverDelay() time.Duration {
+	if delay, ok := core.CoreConfig["failoverdelay"].(int); ok && delay >= 0 {
+		return time.Duration(delay) * time.Second
+	}
+	return defaultFailoverDelay * time.Second
+}
+
+// WatchWorkers 订阅节点下线(注册信息删除或租约过期), 其他节点下线时回调 onLost, 直到 ctx 取消
+// onLost 收到同一个 ctx, 失去 leadership 时需要放弃未完成的转移
+func (wm *WorkerManager) WatchWorkers(ctx context.Context, onLost func(context.Context, Worker)) {
+	cancel := wm.view.Subscribe(func(ev WorkerEvent) {
+		if ev.Type != WorkerRemoved || ev.Worker.ID == wm.worker.ID {
+			return
+		}
+		level.Warn(log.Logger).Log("msg", "Worker lost", "id", ev.Worker.ID, "hostname", ev.Worker.Hostname)
+		go onLost(ctx, ev.Worker)
+	})
+	defer cancel()
+	<-ctx.Done()
+}
+
+// Lock 集群互斥锁, 持有锁期间执行 fn, 持锁节点宕机时锁随 session 过期释放
+func (wm *WorkerManager) Lock(ctx context.Context, key string, fn func() error) error {
+	session, err := concurrency.NewSession(wm.etcd, concurrency.WithTTL(int(wm.ttl)))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	mutex := concurrency.NewMutex(session, lockPrefix+key)
+	if err = mutex.Lock(ctx); err != nil {
+		return err
+	}
+	defer mutex.Unlock(context.Background())
+	return fn()
+}
+
+// IsAlive 节点是否在线
+func (wm *WorkerManager) IsAlive(hostname string) (bool, error) {
+	if _, err := wm.view.Workers(); err != nil {
+		return false, err
+	}
+	_, ok := wm.view.Get(hostname)
+	return ok, nil
+}
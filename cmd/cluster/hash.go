@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// 每个节点在环上的虚拟节点数
+const defaultVirtualNodes = 160
+
+// HashRing 一致性哈希环, 节点增减时只有相邻区间的 key 会迁移
+type HashRing struct {
+	replicas int
+	keys     []uint32
+	nodes    map[uint32]string
+}
+
+func NewHashRing(replicas int, nodes ...string) *HashRing {
+	if replicas <= 0 {
+		replicas = defaultVirtualNodes
+	}
+	r := &HashRing{
+		replicas: replicas,
+		nodes:    make(map[uint32]string),
+	}
+	r.Add(nodes...)
+	return r
+}
+
+func (r *HashRing) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + node))
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = node
+			r.keys = append(r.keys, h)
+		}
+	}
+	sort.Slice(r.keys, func(i, j int) bool { return r.keys[i] < r.keys[j] })
+}
+
+// Get 返回 key 顺时针方向的第一个节点, 环为空时返回空字符串
+func (r *HashRing) Get(key string) string {
+	if len(r.keys) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= h })
+	if idx == len(r.keys) {
+		idx = 0
+	}
+	return r.nodes[r.keys[idx]]
+}
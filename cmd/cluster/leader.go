@@ -0,0 +1,174 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"wsystemd/cmd/log"
+
+	"github.com/go-kit/kit/log/level"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const electionPrefix = "/election/leader"
+
+var ErrNoLeader = errors.New("no leader elected")
+
+// LeaderInfo 当前 leader, Term 为 leader key 的创建版本, 每次选举递增
+type LeaderInfo struct {
+	ID       string    `json:"id"`
+	Hostname string    `json:"hostname"`
+	IP       string    `json:"ip"`
+	Port     string    `json:"port"`
+	Since    time.Time `json:"since"`
+	Term     int64     `json:"term"`
+}
+
+type leaderTask struct {
+	name string
+	fn   func(ctx context.Context)
+}
+
+var (
+	leaderLock  sync.RWMutex
+	leaderTasks []leaderTask
+	isLeader    bool
+)
+
+// RegisterLeaderTask 注册只在 leader 上运行的集群任务
+// 成为 leader 时启动, 失去 leadership 时 ctx 被取消, fn 需要在 ctx 取消后返回
+func RegisterLeaderTask(name string, fn func(ctx context.Context)) {
+	leaderLock.Lock()
+	leaderTasks = append(leaderTasks, leaderTask{name: name, fn: fn})
+	leaderLock.Unlock()
+}
+
+// IsLeader 本节点是否为 leader
+func IsLeader() bool {
+	leaderLock.RLock()
+	defer leaderLock.RUnlock()
+	return isLeader
+}
+
+func setLeader(leader bool) {
+	leaderLock.Lock()
+	isLeader = leader
+	leaderLock.Unlock()
+}
+
+// RunElection 参与 leader 选举直到 ctx 取消, session 失效后重新参选
+func (wm *WorkerManager) RunElection(ctx context.Context) {
+	for {
+		if err := wm.campaign(ctx); err != nil && ctx.Err() == nil {
+			level.Error(log.Logger).Log("msg", "Leader election err", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (wm *WorkerManager) campaign(ctx context.Context) error {
+	session, err := concurrency.NewSession(wm.etcd, concurrency.WithTTL(int(wm.ttl)))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	info := LeaderInfo{
+		ID:       wm.worker.ID,
+		Hostname: wm.worker.Hostname,
+		IP:       wm.worker.IP,
+		Port:     wm.worker.Port,
+	}
+	value, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	election := concurrency.NewElection(session, electionPrefix)
+	if err = election.Campaign(ctx, string(value)); err != nil {
+		return err
+	}
+
+	// 当选后发布任期及当选时间
+	info.Since = time.Now()
+	info.Term = election.Rev()
+	if value, err = json.Marshal(info); err == nil {
+		err = election.Proclaim(ctx, string(value))
+	}
+	if err != nil {
+		level.Warn(log.Logger).Log("msg", "Proclaim leader err", "err", err)
+	}
+
+	level.Info(log.Logger).Log("msg", "Became leader", "id", wm.worker.ID, "term", election.Rev())
+	leaderCtx, cancel := context.WithCancel(ctx)
+	setLeader(true)
+	wg := wm.startLeaderTasks(leaderCtx)
+
+	select {
+	case <-ctx.Done():
+	case <-session.Done():
+		level.Warn(log.Logger).Log("msg", "Leader session expired", "id", wm.worker.ID)
+	}
+
+	setLeader(false)
+	cancel()
+	wg.Wait()
+
+	resignCtx, resignCancel := wm.conf.WithTimeout(context.Background())
+	defer resignCancel()
+	if err = election.Resign(resignCtx); err != nil {
+		level.Warn(log.Logger).Log("msg", "Resign leader err", "err", err)
+	}
+	level.Info(log.Logger).Log("msg", "Leadership released", "id", wm.worker.ID)
+	return nil
+}
+
+func (wm *WorkerManager) startLeaderTasks(ctx context.Context) *sync.WaitGroup {
+	leaderLock.RLock()
+	tasks := append([]leaderTask(nil), leaderTasks...)
+	leaderLock.RUnlock()
+
+	wg := &sync.WaitGroup{}
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t leaderTask) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					level.Error(log.Logger).Log("msg", "Panic in leader task", "task", t.name, "error", r)
+				}
+			}()
+			level.Info(log.Logger).Log("msg", "Leader task started", "task", t.name)
+			t.fn(ctx)
+			level.Info(log.Logger).Log("msg", "Leader task stopped", "task", t.name)
+		}(t)
+	}
+	return wg
+}
+
+// GetLeader 查询当前 leader, 即 election 前缀下创建版本最小的 key
+func (wm *WorkerManager) GetLeader(ctx context.Context) (*LeaderInfo, error) {
+	ctx, cancel := wm.conf.WithTimeout(ctx)
+	defer cancel()
+	resp, err := wm.etcd.Get(ctx, electionPrefix+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNoLeader
+	}
+
+	var leader LeaderInfo
+	if err = json.Unmarshal(resp.Kvs[0].Value, &leader); err != nil {
+		return nil, err
+	}
+	leader.Term = resp.Kvs[0].CreateRevision
+	return &leader, nil
+}
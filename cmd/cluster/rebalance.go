@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"sort"
+	"sync"
+	"wsystemd/cmd/http/core"
+)
+
+// 均衡指标
+const (
+	RebalanceTaskCount = "taskCount"
+	RebalanceCpu       = "cpu"
+	RebalanceMem       = "mem"
+	RebalanceLoad      = "load"
+)
+
+const (
+	defaultRebalanceInterval  = 60
+	defaultRebalanceThreshold = 5
+	defaultRebalanceMaxMoves  = 1
+)
+
+type RebalanceConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 检查间隔, 单位秒
+	Interval int `mapstructure:"interval"`
+	// 均衡指标: taskCount/cpu/mem/load
+	Metric string `mapstructure:"metric"`
+	// 最高与最低节点的指标差超过阈值才迁移
+	Threshold float64 `mapstructure:"threshold"`
+	// 每轮最多迁移的任务数, 用于限速
+	MaxMoves int `mapstructure:"maxmoves"`
+}
+
+var (
+	rebalanceConfig     *RebalanceConfig
+	rebalanceConfigOnce sync.Once
+)
+
+// GetRebalanceConfig 读取 rebalance 配置, 未配置时不启用
+func GetRebalanceConfig() *RebalanceConfig {
+	rebalanceConfigOnce.Do(func() {
+		rebalanceConfig = &RebalanceConfig{}
+		if conf, err := core.GetSingleConfig(core.CoreConfig, "rebalance", RebalanceConfig{}); err == nil {
+			rebalanceConfig = conf.(*RebalanceConfig)
+		}
+		rebalanceConfig.withDefaults()
+	})
+	return rebalanceConfig
+}
+
+func (c *RebalanceConfig) withDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = defaultRebalanceInterval
+	}
+	if c.Metric == "" {
+		c.Metric = RebalanceTaskCount
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = defaultRebalanceThreshold
+	}
+	if c.MaxMoves <= 0 {
+		c.MaxMoves = defaultRebalanceMaxMoves
+	}
+}
+
+// Move 一次迁移, 从 From 节点迁移一个任务到 To 节点
+type Move struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	FromValue float64 `json:"fromValue"`
+	ToValue   float64 `json:"toValue"`
+}
+
+func metricOf(w *Worker, metric string) float64 {
+	switch metric {
+	case RebalanceCpu:
+		return w.Resources.CPUUsage
+	case RebalanceMem:
+		return w.Resources.MemoryUsage
+	case RebalanceLoad:
+		return w.Resources.LoadUsage
+	}
+	return float64(w.Resources.TaskCount)
+}
+
+// PlanRebalance 计算迁移计划, 只在 active 节点之间迁移
+// 每次从指标最高的节点迁移一个任务到最低的节点, 按单个任务的平均占用估算迁移后的指标, 直到差值不超过阈值
+func PlanRebalance(workers []Worker, conf *RebalanceConfig) []Move {
+	type node struct {
+		name  string
+		value float64
+		tasks int
+		// 单个任务的平均占用
+		perTask float64
+	}
+	nodes := make([]*node, 0, len(workers))
+	for i := range workers {
+		w := &workers[i]
+		if w.Status != "" && w.Status != WorkerActive {
+			continue
+		}
+		n := &node{name: w.Hostname, value: metricOf(w, conf.Metric), tasks: w.Resources.TaskCount}
+		if conf.Metric == RebalanceTaskCount {
+			n.perTask = 1
+		} else if n.tasks > 0 {
+			n.perTask = n.value / float64(n.tasks)
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) < 2 {
+		return nil
+	}
+
+	var moves []Move
+	for len(moves) < conf.MaxMoves {
+		sort.Slice(nodes, func(i, j int) bool {
+			if nodes[i].value == nodes[j].value {
+				return nodes[i].name < nodes[j].name
+			}
+			return nodes[i].value < nodes[j].value
+		})
+		low, high := nodes[0], nodes[len(nodes)-1]
+		if high.value-low.value <= conf.Threshold || high.tasks == 0 || high.perTask <= 0 {
+			break
+		}
+		// 迁移后反而更不均衡时停止
+		if low.value+high.perTask >= high.value {
+			break
+		}
+		moves = append(moves, Move{From: high.name, To: low.name, FromValue: high.value, ToValue: low.value})
+		high.value -= high.perTask
+		high.tasks--
+		low.value += high.perTask
+		low.tasks++
+	}
+	return moves
+}
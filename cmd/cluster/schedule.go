@@ -1,20 +1,65 @@
 package cluster
 
-import "wsystemd/cmd/http/core"
+import (
+	"errors"
+	"sort"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+)
 
 var (
-	// taskCount/cpuUsage/memUsage/loadUsage
+	// taskCount/cpuUsage/memUsage/loadUsage/weighted
 	ScheduleTaskCount = "taskCount"
 	ScheduleCpuUsage  = "cpuUsage"
 	ScheduleMemUsage  = "memUsage"
 	ScheduleLoadUsage = "loadUsage"
+	ScheduleWeighted  = "weighted"
+
+	ErrNoAvailableWorker = errors.New("no available worker")
+	// 满足约束的节点都超过资源阈值, 资源释放后可以再次调度
+	ErrNoCapacity = errors.New("no worker has capacity")
 )
 
-func GetWorkNode() (string, error) {
-	base, err := WkMg.getWorkBase()
+// GetWorkNode 按任务的 loadMethod 选择节点, 未指定时使用全局 schedule 配置
+// 所有策略都先经过已注册的 Filter, req.Key 用于 hash 策略, 相同 key 在节点不变时总是落在同一节点
+func GetWorkNode(req *ScheduleRequest) (string, error) {
+	workers, err := WkMg.listWorkers()
+	if err != nil {
+		return "", err
+	}
+	if len(workers) == 0 {
+		return "", ErrNoAvailableWorker
+	}
+
+	scheduler := NewScheduler(GetSchedulerConfig())
+	workers, err = scheduler.Filter(req, workers)
 	if err != nil {
 		return "", err
 	}
+
+	switch req.LoadMethod {
+	case consts.Load_Method_RR:
+		sort.Slice(workers, func(i, j int) bool { return workers[i].Hostname < workers[j].Hostname })
+		cursor, err := WkMg.nextRoundRobin()
+		if err != nil {
+			return "", err
+		}
+		return workers[cursor%int64(len(workers))].Hostname, nil
+	case consts.Load_Method_HASH:
+		ring := NewHashRing(defaultVirtualNodes)
+		for _, worker := range workers {
+			ring.Add(worker.Hostname)
+		}
+		return ring.Get(req.Key), nil
+	case consts.Load_Method_CPU:
+		return FindLeastCPUNode(resourcesOf(workers)), nil
+	case consts.Load_Method_LOAD:
+		return FindLeastLoadNode(resourcesOf(workers)), nil
+	case consts.Load_Method_WEIGHTED:
+		return scheduler.Score(req, workers), nil
+	}
+
+	base := resourcesOf(workers)
 	schedule := core.CoreConfig["schedule"]
 	if schedule == ScheduleTaskCount {
 		return FindLeastTasksNode(base), nil
@@ -28,6 +73,9 @@ func GetWorkNode() (string, error) {
 	if schedule == ScheduleLoadUsage {
 		return FindLeastLoadNode(base), nil
 	}
+	if schedule == ScheduleWeighted {
+		return scheduler.Score(req, workers), nil
+	}
 	return "", nil
 }
 
@@ -0,0 +1,313 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"wsystemd/cmd/http/core"
+)
+
+// ScheduleRequest 调度请求
+type ScheduleRequest struct {
+	LoadMethod string
+	Key        string
+
+	// 放置约束, 为空表示不限制
+	Node     string
+	Dc       string
+	Ip       string
+	Selector map[string]string
+
+	// 本轮已放置过任务的节点, 资源信息尚未更新, 按资源不足处理
+	Exclude map[string]bool
+}
+
+// Filter 过滤不满足条件的节点, 返回 nil 表示通过
+type Filter interface {
+	Name() string
+	Filter(req *ScheduleRequest, w *Worker) error
+}
+
+// Scorer 为节点打分, 返回 [0, 100], 分数越高越优先
+// candidates 为通过过滤的全部节点, 用于需要相对归一化的指标
+type Scorer interface {
+	Name() string
+	Score(req *ScheduleRequest, w *Worker, candidates []Worker) float64
+}
+
+type SchedulerConfig struct {
+	// 各打分插件的权重, key 为插件名, 未配置时为 1, 0 表示不参与打分
+	Weights map[string]float64 `mapstructure:"weights"`
+	// 资源阈值, 超过阈值的节点不参与调度, 0 表示不限制
+	Thresholds ThresholdConfig `mapstructure:"thresholds"`
+}
+
+type ThresholdConfig struct {
+	Cpu  float64 `mapstructure:"cpu"`
+	Mem  float64 `mapstructure:"mem"`
+	Load float64 `mapstructure:"load"`
+	Task int     `mapstructure:"task"`
+}
+
+var (
+	pluginLock sync.RWMutex
+	filters    []Filter
+	scorers    []Scorer
+
+	schedulerConfig     *SchedulerConfig
+	schedulerConfigOnce sync.Once
+)
+
+func init() {
+	RegisterFilter(thresholdFilter{})
+	RegisterFilter(excludeFilter{})
+	RegisterScorer(cpuScorer{})
+	RegisterScorer(memScorer{})
+	RegisterScorer(loadScorer{})
+	RegisterScorer(taskScorer{})
+}
+
+// RegisterFilter 注册过滤插件, 对所有调度策略生效
+func RegisterFilter(f Filter) {
+	pluginLock.Lock()
+	filters = append(filters, f)
+	pluginLock.Unlock()
+}
+
+// RegisterScorer 注册打分插件, 仅 weighted 策略使用, 权重读取配置 scheduler.weights.<name>
+func RegisterScorer(s Scorer) {
+	pluginLock.Lock()
+	scorers = append(scorers, s)
+	pluginLock.Unlock()
+}
+
+// GetSchedulerConfig 读取 scheduler 配置, 未配置时返回零值
+func GetSchedulerConfig() *SchedulerConfig {
+	schedulerConfigOnce.Do(func() {
+		schedulerConfig = &SchedulerConfig{}
+		conf, err := core.GetSingleConfig(core.CoreConfig, "scheduler", SchedulerConfig{})
+		if err == nil {
+			schedulerConfig = conf.(*SchedulerConfig)
+		}
+	})
+	return schedulerConfig
+}
+
+type weightedScorer struct {
+	Scorer
+	weight float64
+}
+
+// Scheduler 过滤 + 打分的调度流程
+type Scheduler struct {
+	Filters []Filter
+	scorers []weightedScorer
+}
+
+// NewScheduler 使用已注册的插件和配置中的权重构建调度器
+func NewScheduler(conf *SchedulerConfig) *Scheduler {
+	pluginLock.RLock()
+	defer pluginLock.RUnlock()
+	s := &Scheduler{Filters: append([]Filter(nil), filters...)}
+	for _, scorer := range scorers {
+		weight := 1.0
+		if w, ok := conf.Weights[strings.ToLower(scorer.Name())]; ok {
+			weight = w
+		}
+		s.AddScorer(scorer, weight)
+	}
+	return s
+}
+
+func (s *Scheduler) AddScorer(scorer Scorer, weight float64) {
+	if weight <= 0 {
+		return
+	}
+	s.scorers = append(s.scorers, weightedScorer{Scorer: scorer, weight: weight})
+}
+
+// Filter 返回通过全部过滤插件的节点
+func (s *Scheduler) Filter(req *ScheduleRequest, workers []Worker) ([]Worker, error) {
+	var (
+		candidates = make([]Worker, 0, len(workers))
+		reasons    []string
+		// 被过滤的节点是否都只因资源不足
+		capacity = true
+	)
+	for i := range workers {
+		if err := s.filterOne(req, &workers[i]); err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", workers[i].Hostname, err.Error()))
+			capacity = capacity && errors.Is(err, ErrNoCapacity)
+			continue
+		}
+		candidates = append(candidates, workers[i])
+	}
+	if len(candidates) == 0 {
+		if len(reasons) == 0 {
+			return nil, ErrNoAvailableWorker
+		}
+		if capacity {
+			return nil, fmt.Errorf("%w: %s", ErrNoCapacity, strings.Join(reasons, "; "))
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoAvailableWorker, strings.Join(reasons, "; "))
+	}
+	return candidates, nil
+}
+
+// filterOne 约束等其他过滤插件优先于资源阈值, 只有资源不足时才返回 ErrNoCapacity
+func (s *Scheduler) filterOne(req *ScheduleRequest, w *Worker) error {
+	var capacityErr error
+	for _, f := range s.Filters {
+		err := f.Filter(req, w)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrNoCapacity) {
+			if capacityErr == nil {
+				capacityErr = fmt.Errorf("%s %w", f.Name(), err)
+			}
+			continue
+		}
+		return fmt.Errorf("%s %s", f.Name(), err.Error())
+	}
+	return capacityErr
+}
+
+// Score 按权重汇总各插件的分数, 选择分数最高的节点, 同分时按主机名排序保证结果稳定
+func (s *Scheduler) Score(req *ScheduleRequest, candidates []Worker) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Hostname < candidates[j].Hostname })
+
+	var (
+		best      string
+		bestScore = -1.0
+	)
+	for i := range candidates {
+		var total, weights float64
+		for _, scorer := range s.scorers {
+			total += scorer.weight * scorer.Score(req, &candidates[i], candidates)
+			weights += scorer.weight
+		}
+		if weights > 0 {
+			total /= weights
+		}
+		if total > bestScore {
+			bestScore = total
+			best = candidates[i].Hostname
+		}
+	}
+	return best
+}
+
+// Schedule 过滤后打分选出节点
+func (s *Scheduler) Schedule(req *ScheduleRequest, workers []Worker) (string, error) {
+	candidates, err := s.Filter(req, workers)
+	if err != nil {
+		return "", err
+	}
+	return s.Score(req, candidates), nil
+}
+
+// thresholdFilter 资源使用超过阈值的节点不参与调度
+type thresholdFilter struct{}
+
+func (thresholdFilter) Name() string { return "threshold" }
+
+func (thresholdFilter) Filter(req *ScheduleRequest, w *Worker) error {
+	t := GetSchedulerConfig().Thresholds
+	switch {
+	case t.Cpu > 0 && w.Resources.CPUUsage > t.Cpu:
+		return capacityError(fmt.Sprintf("cpu usage %.1f > %.1f", w.Resources.CPUUsage, t.Cpu))
+	case t.Mem > 0 && w.Resources.MemoryUsage > t.Mem:
+		return capacityError(fmt.Sprintf("memory usage %.1f > %.1f", w.Resources.MemoryUsage, t.Mem))
+	case t.Load > 0 && w.Resources.LoadUsage > t.Load:
+		return capacityError(fmt.Sprintf("load %.2f > %.2f", w.Resources.LoadUsage, t.Load))
+	case t.Task > 0 && w.Resources.TaskCount >= t.Task:
+		return capacityError(fmt.Sprintf("task count %d >= %d", w.Resources.TaskCount, t.Task))
+	}
+	return nil
+}
+
+// excludeFilter 过滤本轮已放置过任务的节点
+type excludeFilter struct{}
+
+func (excludeFilter) Name() string { return "exclude" }
+
+func (excludeFilter) Filter(req *ScheduleRequest, w *Worker) error {
+	if req.Exclude[w.Hostname] {
+		return capacityError("already placed this round")
+	}
+	return nil
+}
+
+// capacityError 节点资源不足, 过滤插件返回该错误时调度失败为 ErrNoCapacity
+type capacityError string
+
+func (e capacityError) Error() string { return string(e) }
+
+func (e capacityError) Is(target error) bool { return target == ErrNoCapacity }
+
+type cpuScorer struct{}
+
+func (cpuScorer) Name() string { return "cpu" }
+
+func (cpuScorer) Score(req *ScheduleRequest, w *Worker, candidates []Worker) float64 {
+	return clampScore(100 - w.Resources.CPUUsage)
+}
+
+type memScorer struct{}
+
+func (memScorer) Name() string { return "mem" }
+
+func (memScorer) Score(req *ScheduleRequest, w *Worker, candidates []Worker) float64 {
+	return clampScore(100 - w.Resources.MemoryUsage)
+}
+
+// loadScorer load 没有上限, 在候选节点间归一化
+type loadScorer struct{}
+
+func (loadScorer) Name() string { return "load" }
+
+func (loadScorer) Score(req *ScheduleRequest, w *Worker, candidates []Worker) float64 {
+	return relativeScore(w.Resources.LoadUsage, candidates, func(c *Worker) float64 { return c.Resources.LoadUsage })
+}
+
+type taskScorer struct{}
+
+func (taskScorer) Name() string { return "task" }
+
+func (taskScorer) Score(req *ScheduleRequest, w *Worker, candidates []Worker) float64 {
+	return relativeScore(float64(w.Resources.TaskCount), candidates, func(c *Worker) float64 { return float64(c.Resources.TaskCount) })
+}
+
+// relativeScore 最小值得 100 分, 最大值得 0 分
+func relativeScore(v float64, candidates []Worker, metric func(*Worker) float64) float64 {
+	minV, maxV := v, v
+	for i := range candidates {
+		m := metric(&candidates[i])
+		if m < minV {
+			minV = m
+		}
+		if m > maxV {
+			maxV = m
+		}
+	}
+	if maxV == minV {
+		return 100
+	}
+	return 100 * (maxV - v) / (maxV - minV)
+}
+
+func clampScore(score float64) float64 {
+	if score < 0 {
+		return 0
+	}
+	if score > 100 {
+		return 100
+	}
+	return score
+}
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 节点间请求的签名头, 带有效签名的请求视为其他节点转发的请求
+const (
+	ForwardedHeader = "X-Wsystemd-Forwarded" // 发起转发的节点主机名
+	TimestampHeader = "X-Wsystemd-Timestamp"
+	NonceHeader     = "X-Wsystemd-Nonce" // 每个请求随机生成, 时间窗口内重复出现视为重放
+	SignatureHeader = "X-Wsystemd-Signature"
+)
+
+const defaultRpcMaxSkew = 60
+
+var (
+	ErrMissingSignature = errors.New("missing worker signature")
+	ErrInvalidSignature = errors.New("invalid worker signature")
+	ErrSignatureExpired = errors.New("worker signature expired")
+	ErrReplayed         = errors.New("worker request replayed")
+	ErrNoSecret         = errors.New("rpc secret is not configured")
+)
+
+// seenNonces 时间窗口内已使用的 nonce 及其过期时间
+var seenNonces = &nonceCache{nonces: make(map[string]time.Time)}
+
+type nonceCache struct {
+	lock      sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// add 记录 nonce 直到 expire, 已存在且未过期时返回 false
+func (c *nonceCache) add(nonce string, expire, now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for k, v := range c.nonces {
+			if now.After(v) {
+				delete(c.nonces, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	if v, ok := c.nonces[nonce]; ok && !now.After(v) {
+		return false
+	}
+	c.nonces[nonce] = expire
+	return true
+}
+
+// signPayload HMAC-SHA256(secret, method \n path?query \n timestamp \n nonce \n node \n sha256(body))
+func signPayload(secret, method, uri, timestamp, nonce, node string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, uri, timestamp, nonce, node, hex.EncodeToString(bodySum[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest 标记请求来自 node 的转发, 配置了 secret 时附带签名
+func SignRequest(req *http.Request, body []byte, node, secret string) {
+	req.Header.Set(ForwardedHeader, node)
+	if secret == "" {
+		return
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(b)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, nonce)
+	req.Header.Set(SignatureHeader, signPayload(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, node, body))
+}
+
+// VerifyRequest 校验转发请求, 返回发起转发的节点; 时间戳与本机相差超过 maxSkew 秒或 nonce 重复的请求视为重放
+// 未配置 secret 时无法校验签名, 返回 ErrNoSecret
+func VerifyRequest(req *http.Request, body []byte, secret string, maxSkew int) (string, error) {
+	node := req.Header.Get(ForwardedHeader)
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+
+	timestamp, nonce, signature := req.Header.Get(TimestampHeader), req.Header.Get(NonceHeader), req.Header.Get(SignatureHeader)
+	if node == "" || timestamp == "" || nonce == "" || signature == "" {
+		return "", ErrMissingSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if maxSkew <= 0 {
+		maxSkew = defaultRpcMaxSkew
+	}
+	now := time.Now()
+	if skew := now.Unix() - ts; skew > int64(maxSkew) || skew < -int64(maxSkew) {
+		return "", ErrSignatureExpired
+	}
+	expected := signPayload(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, node, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", ErrInvalidSignature
+	}
+	// 签名校验通过后再记录 nonce, 时间戳超出窗口后请求已会被拒绝, nonce 无需继续保留
+	if !seenNonces.add(nonce, time.Unix(ts+int64(maxSkew), 0), now) {
+		return "", ErrReplayed
+	}
+	return node, nil
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 节点状态: active 正常调度, cordoned 不再接收新任务, draining 迁出现有任务
+const (
+	WorkerActive   = "active"
+	WorkerCordoned = "cordoned"
+	WorkerDraining = "draining"
+
+	// 节点状态单独持久化(不绑定租约), 节点重启后保持 cordon/drain
+	workerStatePrefix = "/worker_state/"
+)
+
+var ErrInvalidState = errors.New("invalid worker state")
+
+func init() {
+	RegisterFilter(stateFilter{})
+}
+
+// stateFilter 只调度到 active 节点, 旧版本注册信息没有状态时视为 active
+type stateFilter struct{}
+
+func (stateFilter) Name() string { return "state" }
+
+func (stateFilter) Filter(req *ScheduleRequest, w *Worker) error {
+	if w.Status != "" && w.Status != WorkerActive {
+		return fmt.Errorf("worker is %s", w.Status)
+	}
+	return nil
+}
+
+func ValidState(state string) bool {
+	return state == WorkerActive || state == WorkerCordoned || state == WorkerDraining
+}
+
+// State 本节点当前状态
+func (wm *WorkerManager) State() string {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	return wm.worker.Status
+}
+
+// SetState 修改本节点状态, 持久化后立即刷新注册信息
+func (wm *WorkerManager) SetState(state string) error {
+	if !ValidState(state) {
+		return ErrInvalidState
+	}
+	ctx, cancel := wm.conf.WithTimeout(context.Background())
+	defer cancel()
+
+	stateKey := workerStatePrefix + wm.worker.ID
+	var err error
+	if state == WorkerActive {
+		_, err = wm.etcd.Delete(ctx, stateKey)
+	} else {
+		_, err = wm.etcd.Put(ctx, stateKey, state)
+	}
+	if err != nil {
+		return err
+	}
+
+	wm.mu.Lock()
+	wm.worker.Status = state
+	wm.mu.Unlock()
+
+	data, err := wm.record()
+	if err != nil {
+		return err
+	}
+	_, err = wm.etcd.Put(ctx, wm.workerKey(), string(data), clientv3.WithLease(wm.getLease()))
+	return err
+}
+
+// loadState 启动时恢复上次设置的状态
+func (wm *WorkerManager) loadState(ctx context.Context) error {
+	ctx, cancel := wm.conf.WithTimeout(ctx)
+	defer cancel()
+	resp, err := wm.etcd.Get(ctx, workerStatePrefix+wm.worker.ID)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+	if state := string(resp.Kvs[0].Value); ValidState(state) {
+		wm.mu.Lock()
+		wm.worker.Status = state
+		wm.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"wsystemd/cmd/log"
+
+	"github.com/go-kit/kit/log/level"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var ErrViewNotSynced = errors.New("cluster view not synced")
+
+// 节点变化类型
+const (
+	WorkerAdded = iota
+	WorkerUpdated
+	WorkerRemoved
+)
+
+type WorkerEvent struct {
+	Type   int
+	Worker Worker
+}
+
+// ClusterView 节点信息的本地缓存, 启动时全量读取一次, 之后通过 Watch 增量更新
+type ClusterView struct {
+	etcd    *clientv3.Client
+	conf    *EtcdConfig
+	lock    sync.RWMutex
+	workers map[string]Worker // key 为 etcd key
+	rev     int64
+	synced  bool
+	stale   bool
+	ready   chan struct{}
+
+	subLock sync.RWMutex
+	subs    map[int]func(WorkerEvent)
+	nextSub int
+}
+
+func NewClusterView(cli *clientv3.Client, conf *EtcdConfig) *ClusterView {
+	return &ClusterView{
+		etcd:    cli,
+		conf:    conf,
+		workers: make(map[string]Worker),
+		ready:   make(chan struct{}),
+		subs:    make(map[int]func(WorkerEvent)),
+	}
+}
+
+// Run 维护缓存直到 ctx 取消, Watch 中断期间缓存标记为过期, 恢复后重新全量同步
+func (v *ClusterView) Run(ctx context.Context) {
+	for {
+		if err := v.sync(ctx); err != nil {
+			level.Error(log.Logger).Log("msg", "Sync cluster view err", "err", err)
+		} else {
+			v.watch(ctx)
+		}
+
+		v.lock.Lock()
+		v.stale = true
+		v.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// WaitReady 等待首次同步完成
+func (v *ClusterView) WaitReady(ctx context.Context) error {
+	select {
+	case <-v.ready:
+		return nil
+	case <-ctx.Done():
+		return ErrViewNotSynced
+	}
+}
+
+// sync 全量读取并与缓存比对, 产生增删改事件
+func (v *ClusterView) sync(ctx context.Context) error {
+	reqCtx, cancel := v.conf.WithTimeout(ctx)
+	defer cancel()
+	resp, err := v.etcd.Get(reqCtx, workerPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	latest := make(map[string]Worker, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if worker, ok := decodeWorker(kv); ok {
+			latest[string(kv.Key)] = worker
+		}
+	}
+
+	var events []WorkerEvent
+	v.lock.Lock()
+	for key, worker := range latest {
+		if _, ok := v.workers[key]; ok {
+			events = append(events, WorkerEvent{Type: WorkerUpdated, Worker: worker})
+		} else {
+			events = append(events, WorkerEvent{Type: WorkerAdded, Worker: worker})
+		}
+	}
+	for key, worker := range v.workers {
+		if _, ok := latest[key]; !ok {
+			events = append(events, WorkerEvent{Type: WorkerRemoved, Worker: worker})
+		}
+	}
+	v.workers = latest
+	v.rev = resp.Header.Revision
+	v.stale = false
+	if !v.synced {
+		v.synced = true
+		close(v.ready)
+	}
+	v.lock.Unlock()
+
+	v.publish(events)
+	return nil
+}
+
+func (v *ClusterView) watch(ctx context.Context) {
+	v.lock.RLock()
+	rev := v.rev
+	v.lock.RUnlock()
+
+	wch := v.etcd.Watch(clientv3.WithRequireLeader(ctx), workerPrefix,
+		clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(rev+1))
+	for resp := range wch {
+		if err := resp.Err(); err != nil {
+			level.Error(log.Logger).Log("msg", "Watch workers err", "err", err)
+			return
+		}
+
+		var events []WorkerEvent
+		v.lock.Lock()
+		for _, ev := range resp.Events {
+			key := string(ev.Kv.Key)
+			switch ev.Type {
+			case clientv3.EventTypePut:
+				worker, ok := decodeWorker(ev.Kv)
+				if !ok {
+					continue
+				}
+				typ := WorkerAdded
+				if _, exist := v.workers[key]; exist {
+					typ = WorkerUpdated
+				}
+				v.workers[key] = worker
+				events = append(events, WorkerEvent{Type: typ, Worker: worker})
+			case clientv3.EventTypeDelete:
+				worker, exist := v.workers[key]
+				if !exist {
+					continue
+				}
+				delete(v.workers, key)
+				events = append(events, WorkerEvent{Type: WorkerRemoved, Worker: worker})
+			}
+		}
+		v.rev = resp.Header.Revision
+		v.lock.Unlock()
+
+		v.publish(events)
+	}
+}
+
+// decodeWorker 存活由租约保证, 不带租约的记录来自旧版本或异常退出的节点
+func decodeWorker(kv *mvccpb.KeyValue) (Worker, bool) {
+	var worker Worker
+	if kv.Lease == 0 {
+		return worker, false
+	}
+	if err := json.Unmarshal(kv.Value, &worker); err != nil || worker.Hostname == "" {
+		return worker, false
+	}
+	return worker, true
+}
+
+// Subscribe 订阅节点变化, 回调在同步 goroutine 中执行, 不能阻塞; 返回取消订阅函数
+func (v *ClusterView) Subscribe(fn func(WorkerEvent)) func() {
+	v.subLock.Lock()
+	id := v.nextSub
+	v.nextSub++
+	v.subs[id] = fn
+	v.subLock.Unlock()
+
+	return func() {
+		v.subLock.Lock()
+		delete(v.subs, id)
+		v.subLock.Unlock()
+	}
+}
+
+func (v *ClusterView) publish(events []WorkerEvent) {
+	if len(events) == 0 {
+		return
+	}
+	v.subLock.RLock()
+	defer v.subLock.RUnlock()
+	for _, ev := range events {
+		for _, fn := range v.subs {
+			fn(ev)
+		}
+	}
+}
+
+// Workers 按主机名排序的节点列表
+func (v *ClusterView) Workers() ([]Worker, error) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	if !v.synced {
+		return nil, ErrViewNotSynced
+	}
+	if v.stale {
+		level.Warn(log.Logger).Log("msg", "Cluster view is stale", "rev", v.rev)
+	}
+	workers := make([]Worker, 0, len(v.workers))
+	for _, worker := range v.workers {
+		workers = append(workers, worker)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Hostname < workers[j].Hostname })
+	return workers, nil
+}
+
+// Get 按主机名查找节点
+func (v *ClusterView) Get(hostname string) (Worker, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	for _, worker := range v.workers {
+		if worker.Hostname == hostname {
+			return worker, true
+		}
+	}
+	return Worker{}, false
+}
+
+// Stale Watch 中断后到重新同步前缓存可能落后于 etcd
+func (v *ClusterView) Stale() bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.stale || !v.synced
+}
+
+// Revision 缓存对应的 etcd 版本
+func (v *ClusterView) Revision() int64 {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.rev
+}
@@ -4,9 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
-	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
 	"wsystemd/cmd/http/dto/dao"
 	"wsystemd/cmd/log"
 	"wsystemd/cmd/utils"
@@ -19,28 +20,45 @@ var (
 	WkMg *WorkerManager
 )
 
+const (
+	roundRobinKey = "/schedule/rr"
+	workerPrefix  = "/workers/"
+
+	defaultLeaseTTL = 10
+)
+
 type Worker struct {
-	ID        string
-	Hostname  string
-	IP        string
-	Port      string
-	Status    string
-	LastBeat  time.Time
-	Resources ResourceInfo
+	ID        string            `json:"id"`
+	Hostname  string            `json:"hostname"`
+	IP        string            `json:"ip"`
+	Port      string            `json:"port"`
+	Dc        string            `json:"dc"`
+	IPs       []string          `json:"ips"`
+	Labels    map[string]string `json:"labels"`
+	Status    string            `json:"status"`
+	LastBeat  time.Time         `json:"lastBeat"`
+	Resources ResourceInfo      `json:"resources"`
 }
 
 type ResourceInfo struct {
-	CPUUsage    float64
-	MemoryUsage float64
-	LoadUsage   float64
-	TaskCount   int
+	CPUUsage    float64 `json:"cpuUsage"`
+	MemoryUsage float64 `json:"memoryUsage"`
+	LoadUsage   float64 `json:"loadUsage"`
+	TaskCount   int     `json:"taskCount"`
 }
 
 type WorkerManager struct {
 	etcd      *clientv3.Client
+	conf      *EtcdConfig
 	worker    Worker
 	taskCount int64
-	mu        sync.RWMutex
+	// 注册信息绑定的租约及 TTL(秒)
+	lease clientv3.LeaseID
+	ttl   int64
+	view  *ClusterView
+	mu    sync.RWMutex
+	// 租约失效后重新注册成功时的回调
+	onReRegister []func()
 }
 
 type Task struct {
@@ -52,22 +70,17 @@ type Task struct {
 	CreateTime time.Time
 }
 
-func NewWorkerManager(endpoints []string, workerID string) (*WorkerManager, error) {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: 5 * time.Second,
-	})
+func NewWorkerManager(conf *EtcdConfig, workerID string) (*WorkerManager, error) {
+	cli, err := conf.NewClient()
 	if err != nil {
 		return nil, err
 	}
 
-	hostname, err := utils.GetHostName()
+	worker, err := LocalWorker()
 	if err != nil {
 		return nil, err
 	}
-
-	ip, err := utils.GetLocalIP()
-	if err != nil {
+	if worker.IP, err = utils.GetLocalIP(); err != nil {
 		return nil, err
 	}
 
@@ -86,88 +99,164 @@ func NewWorkerManager(endpoints []string, workerID string) (*WorkerManager, erro
 		return nil, err
 	}
 
+	worker.ID = workerID
+	worker.Status = WorkerActive
+	worker.LastBeat = time.Now()
+	worker.Resources = ResourceInfo{
+		CPUUsage:    cpuUsage,
+		MemoryUsage: memUsage,
+		LoadUsage:   loadUsage,
+		TaskCount:   0,
+	}
 	WkMg = &WorkerManager{
-		etcd: cli,
-		worker: Worker{
-			ID:       workerID,
-			Hostname: hostname,
-			IP:       ip,
-			Port:     consts.ServerPort,
-			Status:   "active",
-			LastBeat: time.Now(),
-			Resources: ResourceInfo{
-				CPUUsage:    cpuUsage,
-				MemoryUsage: memUsage,
-				LoadUsage:   loadUsage,
-				TaskCount:   0,
-			},
-		},
+		etcd:   cli,
+		conf:   conf,
+		worker: worker,
+		ttl:    leaseTTL(),
+		view:   NewClusterView(cli, conf),
 	}
 	return WkMg, nil
 }
 
+// leaseTTL 注册租约 TTL, 配置 leaseTTL(秒), 节点异常退出后最多 TTL 秒从集群中移除
+func leaseTTL() int64 {
+	if ttl, ok := core.CoreConfig["leasettl"].(int); ok && ttl > 0 {
+		return int64(ttl)
+	}
+	return defaultLeaseTTL
+}
+
 func (wm *WorkerManager) Register(ctx context.Context) error {
-	workerKey := fmt.Sprintf("/workers/%s", wm.worker.ID)
-	resp, err := wm.etcd.Get(context.Background(), workerKey)
+	if err := wm.updateResourceInfo(); err != nil {
+		level.Warn(log.Logger).Log("msg", "Failed to update initial resource info", "error", err)
+	}
+
+	if err := wm.loadState(ctx); err != nil {
+		level.Warn(log.Logger).Log("msg", "Failed to load worker state", "error", err)
+	}
+
+	go wm.view.Run(ctx)
+	readyCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := wm.view.WaitReady(readyCtx); err != nil {
+		level.Warn(log.Logger).Log("msg", "Cluster view not ready", "error", err)
+	}
+
+	keepAlive, err := wm.register(ctx)
 	if err != nil {
 		return err
 	}
+	level.Info(log.Logger).Log("msg", "Worker registered successfully", "id", wm.worker.ID, "lease", wm.getLease(), "ttl", wm.ttl)
+
+	go wm.keepAlive(ctx, keepAlive)
+	go wm.updateWorkerStatus(ctx)
+
+	return nil
+}
 
-	if len(resp.Kvs) > 0 {
-		wm.etcd.Delete(context.Background(), workerKey)
+// register 申请租约并写入注册信息, 进程退出后租约过期, 注册信息随之删除
+func (wm *WorkerManager) register(ctx context.Context) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	reqCtx, cancel := wm.conf.WithTimeout(ctx)
+	defer cancel()
+	lease, err := wm.etcd.Grant(reqCtx, wm.ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant lease: %v", err)
 	}
 
-	if err := wm.updateResourceInfo(); err != nil {
-		level.Warn(log.Logger).Log("msg", "Failed to update initial resource info", "error", err)
+	data, err := wm.record()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal worker data: %v", err)
 	}
 
-	workerData := map[string]interface{}{
-		"id":       wm.worker.ID,
-		"hostname": wm.worker.Hostname,
-		"ip":       wm.worker.IP,
-		"port":     wm.worker.Port,
-		"status":   wm.worker.Status,
-		"lastBeat": time.Now(),
-		"resources": map[string]interface{}{
-			"cpuUsage":    wm.worker.Resources.CPUUsage,
-			"memoryUsage": wm.worker.Resources.MemoryUsage,
-			"loadUsage":   wm.worker.Resources.LoadUsage,
-			"taskCount":   wm.GetTaskCount(),
-		},
+	if _, err = wm.etcd.Put(reqCtx, wm.workerKey(), string(data), clientv3.WithLease(lease.ID)); err != nil {
+		wm.revoke(lease.ID)
+		return nil, fmt.Errorf("failed to put worker data to etcd: %v", err)
 	}
-	data, err := json.Marshal(workerData)
+
+	keepAlive, err := wm.etcd.KeepAlive(ctx, lease.ID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal worker data: %v", err)
+		wm.revoke(lease.ID)
+		return nil, fmt.Errorf("failed to keep alive lease: %v", err)
 	}
 
-	_, err = wm.etcd.Put(context.Background(), workerKey, string(data))
-	if err != nil {
-		return fmt.Errorf("failed to put worker data to etcd: %v", err)
+	wm.mu.Lock()
+	wm.lease = lease.ID
+	wm.mu.Unlock()
+	return keepAlive, nil
+}
+
+// keepAlive 续约通道关闭说明租约已失效(etcd 不可达超过 TTL 或被撤销), 重新申请租约注册
+func (wm *WorkerManager) keepAlive(ctx context.Context, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for {
+		for range ch {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		level.Warn(log.Logger).Log("msg", "Worker lease lost, re-registering", "id", wm.worker.ID, "lease", wm.getLease())
+		delay := time.Second
+		for {
+			var err error
+			if ch, err = wm.register(ctx); err == nil {
+				level.Info(log.Logger).Log("msg", "Worker re-registered", "id", wm.worker.ID, "lease", wm.getLease())
+				wm.mu.RLock()
+				for _, fn := range wm.onReRegister {
+					go fn()
+				}
+				wm.mu.RUnlock()
+				break
+			}
+			level.Error(log.Logger).Log("msg", "Failed to re-register worker", "error", err, "id", wm.worker.ID)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			if delay < 30*time.Second {
+				delay *= 2
+			}
+		}
 	}
+}
 
-	level.Info(log.Logger).Log("msg", "Worker registered successfully", "id", wm.worker.ID)
+// OnReRegister 注册重新注册后的回调, 失联期间本节点的任务可能已被转移到其他节点
+func (wm *WorkerManager) OnReRegister(fn func()) {
+	wm.mu.Lock()
+	wm.onReRegister = append(wm.onReRegister, fn)
+	wm.mu.Unlock()
+}
 
-	go wm.updateWorkerStatus(ctx)
+// Deregister 撤销租约, 注册信息立即删除, 退出时调用
+func (wm *WorkerManager) Deregister() {
+	level.Info(log.Logger).Log("msg", "Worker stopping, revoking lease", "id", wm.worker.ID)
+	if err := wm.revoke(wm.getLease()); err != nil {
+		level.Error(log.Logger).Log("msg", "Failed to revoke worker lease", "error", err, "id", wm.worker.ID)
+		return
+	}
+	level.Info(log.Logger).Log("msg", "Worker registration cleaned up successfully", "id", wm.worker.ID)
+}
 
-	return nil
+func (wm *WorkerManager) revoke(lease clientv3.LeaseID) error {
+	ctx, cancel := wm.conf.WithTimeout(context.Background())
+	defer cancel()
+	_, err := wm.etcd.Revoke(ctx, lease)
+	return err
 }
 
+// updateWorkerStatus 定期刷新资源信息, 写入时沿用当前租约
 func (wm *WorkerManager) updateWorkerStatus(ctx context.Context) {
 	level.Info(log.Logger).Log("msg", "Worker status update routine started")
-	workerKey := fmt.Sprintf("/workers/%s", wm.worker.ID)
 	ticker := time.NewTicker(20 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			level.Info(log.Logger).Log("msg", "Worker stopping, cleaning up registration", "id", wm.worker.ID)
-			_, err := wm.etcd.Delete(context.Background(), workerKey)
-			if err != nil {
-				level.Error(log.Logger).Log("msg", "Failed to delete worker info from etcd", "error", err, "id", wm.worker.ID)
-			} else {
-				level.Info(log.Logger).Log("msg", "Worker registration cleaned up successfully", "id", wm.worker.ID)
-			}
 			return
 		case <-ticker.C:
 			if err := wm.updateResourceInfo(); err != nil {
@@ -175,28 +264,16 @@ func (wm *WorkerManager) updateWorkerStatus(ctx context.Context) {
 				continue
 			}
 
-			workerData := map[string]interface{}{
-				"id":       wm.worker.ID,
-				"hostname": wm.worker.Hostname,
-				"ip":       wm.worker.IP,
-				"port":     wm.worker.Port,
-				"status":   wm.worker.Status,
-				"lastBeat": time.Now(),
-				"resources": map[string]interface{}{
-					"cpuUsage":    wm.worker.Resources.CPUUsage,
-					"memoryUsage": wm.worker.Resources.MemoryUsage,
-					"loadUsage":   wm.worker.Resources.LoadUsage,
-					"taskCount":   wm.GetTaskCount(),
-				},
-			}
-
-			data, err := json.Marshal(workerData)
+			data, err := wm.record()
 			if err != nil {
 				level.Error(log.Logger).Log("msg", "Failed to marshal worker data", "error", err)
 				continue
 			}
 
-			_, err = wm.etcd.Put(context.Background(), workerKey, string(data))
+			// 租约失效期间写入会失败, 不会留下不带租约的注册信息
+			reqCtx, cancel := wm.conf.WithTimeout(ctx)
+			_, err = wm.etcd.Put(reqCtx, wm.workerKey(), string(data), clientv3.WithLease(wm.getLease()))
+			cancel()
 			if err != nil {
 				level.Error(log.Logger).Log("msg", "Failed to update worker info", "error", err, "id", wm.worker.ID)
 			}
@@ -204,6 +281,26 @@ func (wm *WorkerManager) updateWorkerStatus(ctx context.Context) {
 	}
 }
 
+func (wm *WorkerManager) workerKey() string {
+	return workerPrefix + wm.worker.ID
+}
+
+func (wm *WorkerManager) getLease() clientv3.LeaseID {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	return wm.lease
+}
+
+// record 当前节点在 etcd 中的注册信息
+func (wm *WorkerManager) record() ([]byte, error) {
+	wm.mu.RLock()
+	worker := wm.worker
+	worker.Resources.TaskCount = int(wm.taskCount)
+	wm.mu.RUnlock()
+	worker.LastBeat = time.Now()
+	return json.Marshal(worker)
+}
+
 func (wm *WorkerManager) IncrTaskCount() {
 	wm.mu.Lock()
 	wm.taskCount++
@@ -254,27 +351,62 @@ func (wm *WorkerManager) updateResourceInfo() error {
 	return nil
 }
 
+func (wm *WorkerManager) listWorkers() ([]Worker, error) {
+	return wm.view.Workers()
+}
+
+// View 集群节点缓存
+func (wm *WorkerManager) View() *ClusterView {
+	return wm.view
+}
+
 func (wm *WorkerManager) getWorkBase() (map[string]ResourceInfo, error) {
-	resp, err := wm.etcd.Get(context.Background(), "/workers/", clientv3.WithPrefix())
+	workers, err := wm.listWorkers()
 	if err != nil {
 		return nil, err
 	}
-	resources := make(map[string]ResourceInfo)
-	for _, kv := range resp.Kvs {
-		var workerData map[string]interface{}
-		if err := json.Unmarshal(kv.Value, &workerData); err != nil {
-			continue
+	return resourcesOf(workers), nil
+}
+
+func resourcesOf(workers []Worker) map[string]ResourceInfo {
+	resources := make(map[string]ResourceInfo, len(workers))
+	for _, worker := range workers {
+		resources[worker.Hostname] = worker.Resources
+	}
+	return resources
+}
+
+// nextRoundRobin 集群共享的轮询游标, 通过 etcd 事务原子递增
+func (wm *WorkerManager) nextRoundRobin() (int64, error) {
+	ctx, cancel := wm.conf.WithTimeout(context.Background())
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		resp, err := wm.etcd.Get(ctx, roundRobinKey)
+		if err != nil {
+			return 0, err
 		}
 
-		hostname := workerData["hostname"].(string)
-		if resourceData, ok := workerData["resources"].(map[string]interface{}); ok {
-			resources[hostname] = ResourceInfo{
-				CPUUsage:    resourceData["cpuUsage"].(float64),
-				MemoryUsage: resourceData["memoryUsage"].(float64),
-				LoadUsage:   resourceData["loadUsage"].(float64),
-				TaskCount:   int(resourceData["taskCount"].(int)),
-			}
+		var (
+			cursor int64
+			cmp    clientv3.Cmp
+		)
+		if len(resp.Kvs) == 0 {
+			cmp = clientv3.Compare(clientv3.CreateRevision(roundRobinKey), "=", 0)
+		} else {
+			cursor, _ = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+			cmp = clientv3.Compare(clientv3.ModRevision(roundRobinKey), "=", resp.Kvs[0].ModRevision)
+		}
+
+		txn, err := wm.etcd.Txn(ctx).
+			If(cmp).
+			Then(clientv3.OpPut(roundRobinKey, strconv.FormatInt(cursor+1, 10))).
+			Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txn.Succeeded {
+			return cursor, nil
 		}
 	}
-	return resources, nil
+	return 0, fmt.Errorf("round robin cursor conflict")
 }
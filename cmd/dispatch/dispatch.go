@@ -1,4 +1,165 @@
 package dispatch
 
-//  任务调度策略
-//	github.com/go-task/task
+// 定时任务调度, 类似 systemd timer: cron 表达式、固定间隔或指定时间执行一次
+// 只负责计算触发时间, 触发后的任务创建由 service 完成
+
+import (
+	"errors"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 定时类型
+const (
+	TypeCron     = "cron"
+	TypeInterval = "interval"
+	TypeOnce     = "once"
+)
+
+// 错过触发时间(如停机期间)的处理策略
+const (
+	MissedSkip    = "skip"    // 跳过错过的触发, 等待下一次
+	MissedRunOnce = "once"    // 只补执行一次
+	MissedCatchUp = "catchup" // 依次补执行所有错过的触发, 最多 MaxCatchUp 次
+)
+
+// 上一次触发的任务仍在运行时的处理策略
+const (
+	ConcurrencyAllow   = "allow"
+	ConcurrencyForbid  = "forbid"
+	ConcurrencyReplace = "replace"
+)
+
+const MaxCatchUp = 100
+
+// 补执行时最多计算的触发次数, cron 周期不固定时按估算的周期跳过后仍可能多于 MaxCatchUp 次
+const maxCatchUpWalk = 10 * MaxCatchUp
+
+var ErrInvalidSchedule = errors.New("invalid timer schedule")
+
+// cron 表达式支持可选的秒字段及 @daily/@every 1h 等描述符
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Schedule 计算 t 之后的下一次触发时间, 没有下一次时返回零值
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+// Parse 按定时类型创建 Schedule, interval 单位秒
+func Parse(typ, expr string, interval int, runAt time.Time) (Schedule, error) {
+	switch typ {
+	case TypeCron:
+		s, err := cronParser.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case TypeInterval:
+		if interval <= 0 {
+			return nil, ErrInvalidSchedule
+		}
+		return intervalSchedule{interval: time.Duration(interval) * time.Second}, nil
+	case TypeOnce:
+		if runAt.IsZero() {
+			return nil, ErrInvalidSchedule
+		}
+		return onceSchedule{at: runAt}, nil
+	}
+	return nil, ErrInvalidSchedule
+}
+
+// First 创建或恢复定时器时的第一次触发时间
+func First(s Schedule, now time.Time) time.Time {
+	if once, ok := s.(onceSchedule); ok {
+		// 已过期的一次性定时器按错过处理
+		return once.at
+	}
+	return s.Next(now)
+}
+
+// Plan 一次到期检查的结果, Run 为 false 时只推进 Next
+type Plan struct {
+	Run      bool
+	FireTime time.Time
+	Next     time.Time
+}
+
+// Due 计算到期的定时器本次是否执行以及下一次触发时间
+// 晚于触发时间超过 tolerance 视为错过, 按 missed 策略处理; next 为零值时已没有下一次
+func Due(s Schedule, missed string, next, now time.Time, tolerance time.Duration) Plan {
+	if next.IsZero() || next.After(now) {
+		return Plan{Next: next}
+	}
+	if now.Sub(next) <= tolerance {
+		return Plan{Run: true, FireTime: next, Next: s.Next(next)}
+	}
+
+	switch missed {
+	case MissedCatchUp:
+		// 错过的次数超过 MaxCatchUp 时只补最近的 MaxCatchUp 次
+		fires := make([]time.Time, 0, MaxCatchUp)
+		t := catchUpStart(s, next, now)
+		for i := 0; i < maxCatchUpWalk && !t.IsZero() && !t.After(now); i++ {
+			if len(fires) == MaxCatchUp {
+				fires = fires[1:]
+			}
+			fires = append(fires, t)
+			t = s.Next(t)
+		}
+		return Plan{Run: true, FireTime: fires[0], Next: s.Next(fires[0])}
+	case MissedRunOnce:
+		return Plan{Run: true, FireTime: next, Next: nextAfter(s, next, now)}
+	}
+	return Plan{Next: nextAfter(s, next, now)}
+}
+
+// catchUpStart 补执行的起点, 停机较久时跳到最近的 MaxCatchUp 个周期, 不逐个遍历所有错过的触发
+func catchUpStart(s Schedule, next, now time.Time) time.Time {
+	if is, ok := s.(intervalSchedule); ok {
+		if n := now.Sub(next) / is.interval; n >= MaxCatchUp {
+			return next.Add((n - MaxCatchUp + 1) * is.interval)
+		}
+		return next
+	}
+	// cron 的周期不固定, 按 now 之后两次触发的间隔估算
+	n1 := s.Next(now)
+	n2 := s.Next(n1)
+	if n1.IsZero() || n2.IsZero() {
+		return next
+	}
+	if start := now.Add(-MaxCatchUp * n2.Sub(n1)); start.After(next) {
+		if t := s.Next(start.Add(-time.Second)); !t.IsZero() && !t.After(now) {
+			return t
+		}
+	}
+	return next
+}
+
+// nextAfter now 之后的第一次触发, 固定间隔保持原来的相位
+func nextAfter(s Schedule, next, now time.Time) time.Time {
+	if is, ok := s.(intervalSchedule); ok {
+		missed := now.Sub(next)/is.interval + 1
+		return next.Add(missed * is.interval)
+	}
+	return s.Next(now)
+}
@@ -0,0 +1,241 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+var (
+	HEngine *Engine
+)
+
+// 探测类型
+const (
+	TypeHttp = "http"
+	TypeCmd  = "cmd"
+	TypeTcp  = "tcp"
+)
+
+// 任务健康状态, 记录在 task.health
+const (
+	StateUnknown   = ""
+	StateHealthy   = "healthy"
+	StateUnhealthy = "unhealthy"
+)
+
+const (
+	defaultInterval = 10
+	defaultFailNum  = 3
+	defaultTimeout  = 5
+)
+
+// Result 单个探测的结果
+type Result struct {
+	Type             string    `json:"type"`
+	Target           string    `json:"target"`
+	State            string    `json:"state"`
+	ConsecutiveFails int       `json:"consecutive_fails"`
+	LastCheck        time.Time `json:"last_check"`
+	LastError        string    `json:"last_error"`
+
+	check params.JobCheck
+}
+
+type jobChecks struct {
+	cancel  context.CancelFunc
+	results []*Result
+	state   string
+}
+
+// Engine 本节点任务的健康检查
+type Engine struct {
+	lock     sync.RWMutex
+	jobs     map[string]*jobChecks
+	onChange func(jobId, state string, r Result)
+}
+
+func NewEngine() *Engine {
+	return &Engine{
+		jobs: make(map[string]*jobChecks),
+	}
+}
+
+// OnChange 注册任务健康状态变化回调, 连续失败达到 FailNum 时回调 unhealthy
+func (e *Engine) OnChange(fn func(jobId, state string, r Result)) {
+	e.lock.Lock()
+	e.onChange = fn
+	e.lock.Unlock()
+}
+
+// Register 开始执行任务的探测, 重复注册会替换之前的探测
+func (e *Engine) Register(jobId string, checks []params.JobCheck) {
+	e.Unregister(jobId)
+	if len(checks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &jobChecks{cancel: cancel}
+	for _, c := range checks {
+		if c.Interval <= 0 {
+			c.Interval = defaultInterval
+		}
+		if c.FailNum <= 0 {
+			c.FailNum = defaultFailNum
+		}
+		if c.Timeout <= 0 {
+			c.Timeout = defaultTimeout
+		}
+		job.results = append(job.results, &Result{Type: c.Type, Target: target(c), check: c})
+	}
+
+	e.lock.Lock()
+	e.jobs[jobId] = job
+	e.lock.Unlock()
+
+	for _, r := range job.results {
+		go e.run(ctx, jobId, job, r)
+	}
+}
+
+func (e *Engine) Unregister(jobId string) {
+	e.lock.Lock()
+	job, ok := e.jobs[jobId]
+	if ok {
+		delete(e.jobs, jobId)
+	}
+	e.lock.Unlock()
+	if ok {
+		job.cancel()
+	}
+}
+
+// Status 任务各探测的最新结果
+func (e *Engine) Status(jobId string) ([]Result, string, bool) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	job, ok := e.jobs[jobId]
+	if !ok {
+		return nil, StateUnknown, false
+	}
+	results := make([]Result, 0, len(job.results))
+	for _, r := range job.results {
+		results = append(results, *r)
+	}
+	return results, job.state, true
+}
+
+func (e *Engine) run(ctx context.Context, jobId string, job *jobChecks, r *Result) {
+	ticker := time.NewTicker(time.Duration(r.check.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := probe(ctx, r.check)
+			if ctx.Err() != nil {
+				return
+			}
+			e.record(jobId, job, r, err)
+		}
+	}
+}
+
+func (e *Engine) record(jobId string, job *jobChecks, r *Result, err error) {
+	var trigger bool
+	e.lock.Lock()
+	r.LastCheck = time.Now()
+	if err == nil {
+		r.State = StateHealthy
+		r.ConsecutiveFails = 0
+		r.LastError = ""
+	} else {
+		r.ConsecutiveFails++
+		r.LastError = err.Error()
+		if r.ConsecutiveFails >= r.check.FailNum {
+			r.State = StateUnhealthy
+			trigger = true
+		}
+	}
+
+	// 任一探测不健康即不健康, 全部健康才算健康
+	state := StateHealthy
+	for _, res := range job.results {
+		if res.State == StateUnhealthy {
+			state = StateUnhealthy
+			break
+		}
+		if res.State == StateUnknown {
+			state = StateUnknown
+		}
+	}
+
+	changed := state != job.state || trigger
+	job.state = state
+	snapshot := *r
+	if trigger {
+		// 触发后重新计数, 避免每个周期重复触发
+		r.ConsecutiveFails = 0
+	}
+	onChange := e.onChange
+	e.lock.Unlock()
+
+	if err != nil {
+		level.Warn(log.Logger).Log("msg", "Health check failed", "jobId", jobId, "type", r.check.Type,
+			"target", snapshot.Target, "fails", snapshot.ConsecutiveFails, "err", err)
+	}
+	if changed && state != StateUnknown && onChange != nil {
+		onChange(jobId, state, snapshot)
+	}
+}
+
+func target(c params.JobCheck) string {
+	if c.Type == TypeCmd {
+		return c.Cmd
+	}
+	return c.Api
+}
+
+func probe(ctx context.Context, c params.JobCheck) error {
+	timeout := time.Duration(c.Timeout) * time.Second
+	switch c.Type {
+	case TypeHttp:
+		client := &http.Client{Timeout: timeout}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Api, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("http status %d", resp.StatusCode)
+		}
+		return nil
+	case TypeCmd:
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return exec.CommandContext(cmdCtx, c.Cmd, c.Args...).Run()
+	case TypeTcp:
+		dialer := &net.Dialer{Timeout: timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", c.Api)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		return fmt.Errorf("unknown check type %s", c.Type)
+	}
+}
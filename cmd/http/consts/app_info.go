@@ -12,11 +12,57 @@ const (
 	DoOnce
 )
 
+// 是否允许 rebalance 迁移: 0-否 1-是
+const (
+	NotMovable = iota
+	Movable
+)
+
+// 任务状态: 0-停止 1-运行中 2-失败
+const (
+	TaskStatusStopped = iota
+	TaskStatusRunning
+	TaskStatusFailed
+)
+
+// 一次性任务执行状态: 0-排队 1-执行中 2-成功 3-失败
+const (
+	ExecStatusQueued = iota
+	ExecStatusRunning
+	ExecStatusSucceeded
+	ExecStatusFailed
+)
+
+// 定时器状态: 0-暂停 1-运行中 2-已结束(一次性定时器已执行)
+const (
+	TimerPaused = iota
+	TimerActive
+	TimerFinished
+)
+
+// 待提交任务状态: 0-等待 1-提交中 2-已提交 3-失败 4-已取消
+const (
+	PendingWaiting = iota
+	PendingSubmitting
+	PendingSubmitted
+	PendingFailed
+	PendingCanceled
+)
+
+// 任务优先级, 待提交队列按优先级从高到低提交
+const (
+	PriorityLow = iota
+	PriorityNormal
+	PriorityHigh
+)
+
 const (
 	Load_Method_RR   = "round_robin"
 	Load_Method_HASH = "hash"
 	Load_Method_CPU  = "cpu"
 	Load_Method_LOAD = "load"
+	// 按 scheduler.weights 综合 cpu/内存/load/任务数打分
+	Load_Method_WEIGHTED = "weighted"
 
 	BigOne = "bigOne"
 )
@@ -99,6 +99,14 @@ func initGorm(conn *MysqlConn) (*gorm.DB, error) {
 	return db, nil
 }
 
+// SetDB 直接设置连接, 用于测试等不读取 mysql 配置的场景
+func SetDB(key string, db *gorm.DB) {
+	if mysqlPool == nil {
+		mysqlPool = make(map[string]*gorm.DB)
+	}
+	mysqlPool[key] = db
+}
+
 func GetDB(key string) (db *gorm.DB, err error) {
 	db, ok := mysqlPool[key]
 	if !ok {
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TLSConfig HTTP 服务证书, 配置 caFile 时校验客户端证书, 节点间调用也使用同一套证书
+type TLSConfig struct {
+	CertFile string `mapstructure:"certfile"`
+	KeyFile  string `mapstructure:"keyfile"`
+	CaFile   string `mapstructure:"cafile"`
+}
+
+var (
+	tlsConfig     *TLSConfig
+	tlsConfigOnce sync.Once
+)
+
+// GetTLSConfig 读取 tls 配置, 未配置时返回空配置
+func GetTLSConfig() *TLSConfig {
+	tlsConfigOnce.Do(func() {
+		tlsConfig = &TLSConfig{}
+		if conf, err := GetSingleConfig(CoreConfig, "tls", TLSConfig{}); err == nil {
+			tlsConfig = conf.(*TLSConfig)
+		}
+	})
+	return tlsConfig
+}
+
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+func (c *TLSConfig) caPool() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(c.CaFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", c.CaFile)
+	}
+	return pool, nil
+}
+
+// ServerConfig 客户端证书可选, 未带证书的请求仍可使用 token 认证
+func (c *TLSConfig) ServerConfig() (*tls.Config, error) {
+	if !c.Enabled() {
+		return nil, errors.New("tls certFile and keyFile are required")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.CaFile != "" {
+		if conf.ClientCAs, err = c.caPool(); err != nil {
+			return nil, err
+		}
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return conf, nil
+}
+
+// ClientConfig 节点间调用时出示本节点证书, 并用 caFile 校验对端
+func (c *TLSConfig) ClientConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.CaFile != "" {
+		if conf.RootCAs, err = c.caPool(); err != nil {
+			return nil, err
+		}
+	}
+	return conf, nil
+}
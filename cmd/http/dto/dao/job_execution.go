@@ -0,0 +1,82 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+
+	"gorm.io/gorm"
+)
+
+type JobExecution struct {
+	DB *gorm.DB
+}
+
+func (e *JobExecution) WithContext(ctx context.Context) *JobExecution {
+	e.DB, _ = core.GetDB(core.DB_VRW)
+	e.DB.WithContext(ctx)
+	return e
+}
+
+func (e *JobExecution) Create(model *entity.JobExecution) error {
+	return e.DB.Model(&entity.JobExecution{}).
+		Create(model).Error
+}
+
+func (e *JobExecution) FindByExecId(execId string) (*entity.JobExecution, error) {
+	model := &entity.JobExecution{}
+	err := e.DB.Model(&entity.JobExecution{}).
+		Where("exec_id = ?", execId).
+		Find(model).Error
+	return model, err
+}
+
+type ExecutionFilter struct {
+	Node   string
+	Status *int64
+}
+
+// List 游标分页, 不返回 stdout/stderr
+func (e *JobExecution) List(filter ExecutionFilter, cursor int64, limit int) ([]entity.JobExecution, error) {
+	db := e.DB.Model(&entity.JobExecution{}).Where("id > ?", cursor)
+	if filter.Node != "" {
+		db = db.Where("node = ?", filter.Node)
+	}
+	if filter.Status != nil {
+		db = db.Where("status = ?", *filter.Status)
+	}
+	list := []entity.JobExecution{}
+	err := db.Omit("stdout", "stderr").Order("id ASC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// UpdateRunning 开始执行, 只更新仍在排队的记录
+func (e *JobExecution) UpdateRunning(id int64, startTime time.Time) error {
+	return e.DB.Model(&entity.JobExecution{}).
+		Where("id = ? AND status = ?", id, consts.ExecStatusQueued).
+		Updates(map[string]interface{}{
+			"status":      consts.ExecStatusRunning,
+			"start_time":  startTime,
+			"update_time": time.Now(),
+		}).Error
+}
+
+// UpdateResult 记录执行结果
+func (e *JobExecution) UpdateResult(model *entity.JobExecution) error {
+	return e.DB.Model(&entity.JobExecution{}).
+		Where("id = ?", model.ID).
+		Updates(map[string]interface{}{
+			"status":      model.Status,
+			"outcome":     model.Outcome,
+			"exit_code":   model.ExitCode,
+			"duration_ms": model.DurationMs,
+			"stdout":      model.Stdout,
+			"stderr":      model.Stderr,
+			"truncated":   model.Truncated,
+			"last_error":  model.LastError,
+			"end_time":    model.EndTime,
+			"update_time": time.Now(),
+		}).Error
+}
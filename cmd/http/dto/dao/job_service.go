@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+
+	"gorm.io/gorm"
+)
+
+type JobService struct {
+	DB *gorm.DB
+}
+
+func (s *JobService) WithContext(ctx context.Context) *JobService {
+	s.DB, _ = core.GetDB(core.DB_VRW)
+	s.DB.WithContext(ctx)
+	return s
+}
+
+func (s *JobService) Create(model *entity.JobService) error {
+	return s.DB.Model(&entity.JobService{}).
+		Create(model).Error
+}
+
+func (s *JobService) FindByServiceId(serviceId string) (*entity.JobService, error) {
+	model := &entity.JobService{}
+	err := s.DB.Model(&entity.JobService{}).
+		Where("service_id = ?", serviceId).
+		Find(model).Error
+	return model, err
+}
+
+func (s *JobService) UpdateReplicas(serviceId string, replicas int) error {
+	return s.DB.Model(&entity.JobService{}).
+		Where("service_id = ?", serviceId).
+		Updates(map[string]interface{}{
+			"replicas":    replicas,
+			"update_time": time.Now(),
+		}).Error
+}
+
+func (s *JobService) DeleteByServiceId(serviceId string) error {
+	return s.DB.Model(&entity.JobService{}).
+		Where("service_id = ?", serviceId).
+		Delete(&entity.JobService{}).
+		Error
+}
@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+
+	"gorm.io/gorm"
+)
+
+type JobTimer struct {
+	DB *gorm.DB
+}
+
+func (t *JobTimer) WithContext(ctx context.Context) *JobTimer {
+	t.DB, _ = core.GetDB(core.DB_VRW)
+	t.DB.WithContext(ctx)
+	return t
+}
+
+func (t *JobTimer) Create(model *entity.JobTimer) error {
+	return t.DB.Model(&entity.JobTimer{}).
+		Create(model).Error
+}
+
+func (t *JobTimer) FindByTimerId(timerId string) (*entity.JobTimer, error) {
+	model := &entity.JobTimer{}
+	err := t.DB.Model(&entity.JobTimer{}).
+		Where("timer_id = ?", timerId).
+		Find(model).Error
+	return model, err
+}
+
+func (t *JobTimer) DeleteByTimerId(timerId string) error {
+	return t.DB.Where("timer_id = ?", timerId).
+		Delete(&entity.JobTimer{}).Error
+}
+
+// List 游标分页, 返回 id > cursor 的前 limit 条
+func (t *JobTimer) List(cursor int64, limit int) ([]entity.JobTimer, error) {
+	list := []entity.JobTimer{}
+	err := t.DB.Model(&entity.JobTimer{}).
+		Where("id > ?", cursor).
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListDue 已到触发时间的定时器
+func (t *JobTimer) ListDue(now time.Time, limit int) ([]entity.JobTimer, error) {
+	list := []entity.JobTimer{}
+	err := t.DB.Model(&entity.JobTimer{}).
+		Where("status = ? AND next_run_time <= ?", consts.TimerActive, now).
+		Order("next_run_time ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// Claim 仅当 version 未变化时推进下一次触发时间, 返回是否抢占成功, 保证每次触发只执行一次
+// fireTime 为零值表示本次不执行, next 为零值表示没有下一次, 定时器结束
+func (t *JobTimer) Claim(id, version int64, fireTime, next time.Time) (bool, error) {
+	updates := map[string]interface{}{
+		"version":     gorm.Expr("version + 1"),
+		"update_time": time.Now(),
+	}
+	if !fireTime.IsZero() {
+		updates["last_run_time"] = fireTime
+	}
+	if next.IsZero() {
+		updates["status"] = consts.TimerFinished
+	} else {
+		updates["next_run_time"] = next
+	}
+	db := t.DB.Model(&entity.JobTimer{}).
+		Where("id = ? AND version = ?", id, version).
+		Updates(updates)
+	return db.RowsAffected > 0, db.Error
+}
+
+func (t *JobTimer) UpdateLastJob(id int64, jobId, lastError string) error {
+	updates := map[string]interface{}{
+		"last_error":  lastError,
+		"update_time": time.Now(),
+	}
+	if jobId != "" {
+		updates["last_job_id"] = jobId
+	}
+	return t.DB.Model(&entity.JobTimer{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+// UpdateStatus 暂停或恢复, 恢复时重新计算下一次触发时间
+func (t *JobTimer) UpdateStatus(id int64, status int64, next time.Time) error {
+	updates := map[string]interface{}{
+		"status":      status,
+		"version":     gorm.Expr("version + 1"),
+		"update_time": time.Now(),
+	}
+	if !next.IsZero() {
+		updates["next_run_time"] = next
+	}
+	return t.DB.Model(&entity.JobTimer{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
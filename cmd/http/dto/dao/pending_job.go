@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+
+	"gorm.io/gorm"
+)
+
+type PendingJob struct {
+	DB *gorm.DB
+}
+
+func (p *PendingJob) WithContext(ctx context.Context) *PendingJob {
+	p.DB, _ = core.GetDB(core.DB_VRW)
+	p.DB.WithContext(ctx)
+	return p
+}
+
+func (p *PendingJob) Create(model *entity.PendingJob) error {
+	return p.DB.Model(&entity.PendingJob{}).
+		Create(model).Error
+}
+
+func (p *PendingJob) FindByPendingId(pendingId string) (*entity.PendingJob, error) {
+	model := &entity.PendingJob{}
+	err := p.DB.Model(&entity.PendingJob{}).
+		Where("pending_id = ?", pendingId).
+		Find(model).Error
+	return model, err
+}
+
+// List 游标分页, status 为 nil 时不过滤
+func (p *PendingJob) List(status *int64, cursor int64, limit int) ([]entity.PendingJob, error) {
+	list := []entity.PendingJob{}
+	db := p.DB.Model(&entity.PendingJob{}).
+		Where("id > ?", cursor)
+	if status != nil {
+		db = db.Where("status = ?", *status)
+	}
+	err := db.Order("id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListDue 已到提交时间的任务, 按优先级从高到低, 同优先级先到先提交
+func (p *PendingJob) ListDue(now time.Time, limit int) ([]entity.PendingJob, error) {
+	list := []entity.PendingJob{}
+	err := p.DB.Model(&entity.PendingJob{}).
+		Where("status = ? AND submit_at <= ?", consts.PendingWaiting, now).
+		Order("priority DESC, submit_at ASC, id ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// ListStale 提交中且 before 之后没有更新的任务
+func (p *PendingJob) ListStale(before time.Time, limit int) ([]entity.PendingJob, error) {
+	list := []entity.PendingJob{}
+	err := p.DB.Model(&entity.PendingJob{}).
+		Where("status = ? AND update_time < ?", consts.PendingSubmitting, before).
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+// UpdateStatus 仅当状态为 from 时更新, 返回是否更新成功
+func (p *PendingJob) UpdateStatus(id, from, to int64, updates map[string]interface{}) (bool, error) {
+	values := map[string]interface{}{
+		"status":      to,
+		"update_time": time.Now(),
+	}
+	for k, v := range updates {
+		values[k] = v
+	}
+	db := p.DB.Model(&entity.PendingJob{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(values)
+	return db.RowsAffected > 0, db.Error
+}
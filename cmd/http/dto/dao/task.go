@@ -87,12 +87,14 @@ func (t *Task) UpdateHeartBeatTime(id int64) error {
 		Error
 }
 
-func (t *Task) UpdatePid(id int64, pid int) error {
+func (t *Task) UpdatePid(id int64, pid int, procStartTime int64, token string) error {
 	return t.DB.Model(&entity.Task{}).
 		Where("id = ?", id).
 		Updates(entity.Task{
 			HeartBeatTime: time.Now(),
 			Pid:           pid,
+			ProcStartTime: procStartTime,
+			Token:         token,
 		}).Error
 }
 
@@ -120,6 +122,29 @@ func (t *Task) GetNodeTaskCount() (map[string]int64, error) {
 	return stats, nil
 }
 
+// GetNodeRunningTaskCount 各节点运行中的常驻任务数, 不包含已停止或失败的记录
+func (t *Task) GetNodeRunningTaskCount() (map[string]int64, error) {
+	var results []struct {
+		Node  string
+		Count int64
+	}
+
+	err := t.DB.Model(&entity.Task{}).
+		Select("node, count(*) as count").
+		Where("do_once = ? AND status = ?", consts.NotDoOnce, consts.TaskStatusRunning).
+		Group("node").
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]int64)
+	for _, r := range results {
+		stats[r.Node] = r.Count
+	}
+	return stats, nil
+}
+
 func (t *Task) GetTargetNodeTaskCount(node string) (int64, error) {
 	var count int64
 	err := t.DB.Model(&entity.Task{}).
@@ -129,3 +154,117 @@ func (t *Task) GetTargetNodeTaskCount(node string) (int64, error) {
 
 	return count, err
 }
+
+type TaskFilter struct {
+	Node      string
+	Dc        string
+	Ip        string
+	Status    *int64
+	DoOnce    *int64
+	BigOne    *bool
+	Movable   *int64
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// List 按条件游标分页查询, 返回 id > cursor 的前 limit 条
+func (t *Task) List(filter TaskFilter, cursor int64, limit int) ([]entity.Task, error) {
+	db := t.DB.Model(&entity.Task{}).Where("id > ?", cursor)
+	if filter.Node != "" {
+		db = db.Where("node = ?", filter.Node)
+	}
+	if filter.Dc != "" {
+		db = db.Where("dc = ?", filter.Dc)
+	}
+	if filter.Ip != "" {
+		db = db.Where("ip = ?", filter.Ip)
+	}
+	if filter.Status != nil {
+		db = db.Where("status = ?", *filter.Status)
+	}
+	if filter.DoOnce != nil {
+		db = db.Where("do_once = ?", *filter.DoOnce)
+	}
+	if filter.BigOne != nil {
+		if *filter.BigOne {
+			db = db.Where("big_one = ?", consts.BigOne)
+		} else {
+			db = db.Where("big_one = ''")
+		}
+	}
+	if filter.Movable != nil {
+		db = db.Where("movable = ?", *filter.Movable)
+	}
+	if !filter.StartTime.IsZero() {
+		db = db.Where("create_time >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		db = db.Where("create_time <= ?", filter.EndTime)
+	}
+
+	list := []entity.Task{}
+	err := db.Order("id ASC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+func (t *Task) GetByJobId(jobId string) (*entity.Task, error) {
+	tModel := &entity.Task{}
+	err := t.DB.Model(&entity.Task{}).
+		Where("job_id = ?", jobId).
+		Find(tModel).Error
+	return tModel, err
+}
+
+func (t *Task) UpdateExit(id int64, status int64, outcome, lastError string) error {
+	return t.DB.Model(&entity.Task{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"outcome":     outcome,
+			"last_error":  lastError,
+			"update_time": time.Now(),
+		}).Error
+}
+
+func (t *Task) IncrRetryCount(id int64) error {
+	return t.DB.Model(&entity.Task{}).
+		Where("id = ?", id).
+		Update("retry_count", gorm.Expr("retry_count + 1")).
+		Error
+}
+
+func (t *Task) UpdateHealth(id int64, health, lastError string) error {
+	updates := map[string]interface{}{
+		"health":      health,
+		"update_time": time.Now(),
+	}
+	if lastError != "" {
+		updates["last_error"] = lastError
+	}
+	return t.DB.Model(&entity.Task{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
+func (t *Task) ListByParentId(parentId string) ([]entity.Task, error) {
+	list := []entity.Task{}
+	err := t.DB.Model(&entity.Task{}).
+		Where("parent_id = ?", parentId).
+		Order("replica ASC").
+		Find(&list).Error
+	return list, err
+}
+
+// MoveNode 仅当任务仍属于 fromNode 时改为 toNode, dc/ip 一并更新为目标节点的值, 返回是否成功, 防止多个节点重复接管
+func (t *Task) MoveNode(id int64, fromNode, toNode, dc, ip string) (bool, error) {
+	db := t.DB.Model(&entity.Task{}).
+		Where("id = ? AND node = ?", id, fromNode).
+		Updates(map[string]interface{}{
+			"node":        toNode,
+			"dc":          dc,
+			"ip":          ip,
+			"pid":         0,
+			"update_time": time.Now(),
+		})
+	return db.RowsAffected > 0, db.Error
+}
@@ -0,0 +1,34 @@
+package dao
+
+import (
+	"context"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+
+	"gorm.io/gorm"
+)
+
+type TaskEvent struct {
+	DB *gorm.DB
+}
+
+func (e *TaskEvent) WithContext(ctx context.Context) *TaskEvent {
+	e.DB, _ = core.GetDB(core.DB_VRW)
+	e.DB.WithContext(ctx)
+	return e
+}
+
+func (e *TaskEvent) Create(model *entity.TaskEvent) error {
+	return e.DB.Model(&entity.TaskEvent{}).
+		Create(model).Error
+}
+
+func (e *TaskEvent) ListByJobId(jobId string, limit int) ([]entity.TaskEvent, error) {
+	list := []entity.TaskEvent{}
+	err := e.DB.Model(&entity.TaskEvent{}).
+		Where("job_id = ?", jobId).
+		Order("id DESC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
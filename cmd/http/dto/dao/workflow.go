@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+
+	"gorm.io/gorm"
+)
+
+type Workflow struct {
+	DB *gorm.DB
+}
+
+func (w *Workflow) WithContext(ctx context.Context) *Workflow {
+	w.DB, _ = core.GetDB(core.DB_VRW)
+	w.DB.WithContext(ctx)
+	return w
+}
+
+// CreateWithSteps 在同一事务中创建工作流及其步骤
+func (w *Workflow) CreateWithSteps(model *entity.Workflow, steps []entity.WorkflowStep) error {
+	return w.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.Workflow{}).Create(model).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.WorkflowStep{}).Create(&steps).Error
+	})
+}
+
+func (w *Workflow) FindByWorkflowId(workflowId string) (*entity.Workflow, error) {
+	model := &entity.Workflow{}
+	err := w.DB.Model(&entity.Workflow{}).
+		Where("workflow_id = ?", workflowId).
+		Find(model).Error
+	return model, err
+}
+
+// List 游标分页, status 为 nil 时不过滤
+func (w *Workflow) List(status *int64, cursor int64, limit int) ([]entity.Workflow, error) {
+	db := w.DB.Model(&entity.Workflow{}).Where("id > ?", cursor)
+	if status != nil {
+		db = db.Where("status = ?", *status)
+	}
+	list := []entity.Workflow{}
+	err := db.Order("id ASC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// UpdateStatus 仅当工作流仍为 from 状态时更新, 返回是否更新成功
+func (w *Workflow) UpdateStatus(id int64, from, to int64, lastError string) (bool, error) {
+	now := time.Now()
+	db := w.DB.Model(&entity.Workflow{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(map[string]interface{}{
+			"status":      to,
+			"last_error":  lastError,
+			"end_time":    now,
+			"update_time": now,
+		})
+	return db.RowsAffected > 0, db.Error
+}
+
+func (w *Workflow) ListSteps(workflowId string) ([]entity.WorkflowStep, error) {
+	list := []entity.WorkflowStep{}
+	err := w.DB.Model(&entity.WorkflowStep{}).
+		Where("workflow_id = ?", workflowId).
+		Order("id ASC").
+		Find(&list).Error
+	return list, err
+}
+
+// UpdateStep 仅当步骤仍为 from 状态时更新, 用于抢占步骤的启动及状态变更
+func (w *Workflow) UpdateStep(id int64, from, to int64, updates map[string]interface{}) (bool, error) {
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = to
+	updates["update_time"] = time.Now()
+	db := w.DB.Model(&entity.WorkflowStep{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return db.RowsAffected > 0, db.Error
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// JobExecution doOnce 任务的一次执行, 提交后排队在所在节点后台执行
+type JobExecution struct {
+	ID         int64      `gorm:"column:id" json:"id" form:"id"`
+	ExecId     string     `gorm:"column:exec_id" json:"exec_id" form:"exec_id"`
+	Node       string     `gorm:"column:node" json:"node" form:"node"`
+	Cmd        string     `gorm:"column:cmd" json:"cmd" form:"cmd"`
+	Args       string     `gorm:"column:args" json:"args" form:"args"`
+	Spec       string     `gorm:"column:spec" json:"spec" form:"spec"`
+	Status     int64      `gorm:"column:status" json:"status" form:"status"`
+	Outcome    string     `gorm:"column:outcome" json:"outcome" form:"outcome"`
+	ExitCode   int        `gorm:"column:exit_code" json:"exit_code" form:"exit_code"`
+	DurationMs int64      `gorm:"column:duration_ms" json:"duration_ms" form:"duration_ms"`
+	Stdout     string     `gorm:"column:stdout" json:"stdout" form:"stdout"`
+	Stderr     string     `gorm:"column:stderr" json:"stderr" form:"stderr"`
+	Truncated  bool       `gorm:"column:truncated" json:"truncated" form:"truncated"`
+	LastError  string     `gorm:"column:last_error" json:"last_error" form:"last_error"`
+	StartTime  *time.Time `gorm:"column:start_time" json:"start_time" form:"start_time"`
+	EndTime    *time.Time `gorm:"column:end_time" json:"end_time" form:"end_time"`
+	CreateTime time.Time  `gorm:"column:create_time" json:"create_time" form:"create_time"`
+	UpdateTime time.Time  `gorm:"column:update_time" json:"update_time" form:"update_time"`
+}
+
+func (e *JobExecution) TableName() string {
+	return "job_execution"
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// JobService 多副本任务, 每个副本对应一条 task 记录(parent_id = service_id)
+type JobService struct {
+	ID         int64     `gorm:"column:id" json:"id" form:"id"`
+	ServiceId  string    `gorm:"column:service_id" json:"service_id" form:"service_id"`
+	Spec       string    `gorm:"column:spec" json:"spec" form:"spec"`
+	Replicas   int       `gorm:"column:replicas" json:"replicas" form:"replicas"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time" form:"create_time"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"update_time" form:"update_time"`
+}
+
+func (s *JobService) TableName() string {
+	return "job_service"
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// JobTimer 定时任务, 到期时按 spec 创建任务; version 用于多个节点抢占同一次触发
+type JobTimer struct {
+	ID                int64      `gorm:"column:id" json:"id" form:"id"`
+	TimerId           string     `gorm:"column:timer_id" json:"timer_id" form:"timer_id"`
+	Name              string     `gorm:"column:name" json:"name" form:"name"`
+	Spec              string     `gorm:"column:spec" json:"spec" form:"spec"`
+	ScheduleType      string     `gorm:"column:schedule_type" json:"schedule_type" form:"schedule_type"`
+	Cron              string     `gorm:"column:cron" json:"cron" form:"cron"`
+	IntervalSec       int        `gorm:"column:interval_sec" json:"interval_sec" form:"interval_sec"`
+	RunAt             *time.Time `gorm:"column:run_at" json:"run_at" form:"run_at"`
+	MissedPolicy      string     `gorm:"column:missed_policy" json:"missed_policy" form:"missed_policy"`
+	ConcurrencyPolicy string     `gorm:"column:concurrency_policy" json:"concurrency_policy" form:"concurrency_policy"`
+	Status            int64      `gorm:"column:status" json:"status" form:"status"`
+	Version           int64      `gorm:"column:version" json:"version" form:"version"`
+	NextRunTime       time.Time  `gorm:"column:next_run_time" json:"next_run_time" form:"next_run_time"`
+	LastRunTime       *time.Time `gorm:"column:last_run_time" json:"last_run_time" form:"last_run_time"`
+	LastJobId         string     `gorm:"column:last_job_id" json:"last_job_id" form:"last_job_id"`
+	LastError         string     `gorm:"column:last_error" json:"last_error" form:"last_error"`
+	CreateTime        time.Time  `gorm:"column:create_time" json:"create_time" form:"create_time"`
+	UpdateTime        time.Time  `gorm:"column:update_time" json:"update_time" form:"update_time"`
+}
+
+func (t *JobTimer) TableName() string {
+	return "job_timer"
+}
@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// PendingJob 待提交任务, 延迟提交或节点资源不足时在队列中等待, 由调度循环按优先级提交
+type PendingJob struct {
+	ID         int64     `gorm:"column:id" json:"id" form:"id"`
+	PendingId  string    `gorm:"column:pending_id" json:"pending_id" form:"pending_id"`
+	Spec       string    `gorm:"column:spec" json:"spec" form:"spec"`
+	Priority   int64     `gorm:"column:priority" json:"priority" form:"priority"`
+	Reason     string    `gorm:"column:reason" json:"reason" form:"reason"`
+	Status     int64     `gorm:"column:status" json:"status" form:"status"`
+	SubmitAt   time.Time `gorm:"column:submit_at" json:"submit_at" form:"submit_at"`
+	Attempts   int       `gorm:"column:attempts" json:"attempts" form:"attempts"`
+	JobId      string    `gorm:"column:job_id" json:"job_id" form:"job_id"`
+	LastError  string    `gorm:"column:last_error" json:"last_error" form:"last_error"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time" form:"create_time"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"update_time" form:"update_time"`
+}
+
+func (p *PendingJob) TableName() string {
+	return "pending_job"
+}
@@ -5,8 +5,12 @@ import "time"
 type Task struct {
 	ID            int64     `gorm:"column:id" json:"id" form:"id"`
 	JobId         string    `gorm:"column:job_id" json:"job_id" form:"job_id"`
+	Token         string    `gorm:"column:token" json:"-" form:"-"` // 进程环境变量 TASK_TOKEN, 心跳上报凭证, 不对外返回
+	ParentId      string    `gorm:"column:parent_id" json:"parent_id" form:"parent_id"`
+	Replica       int       `gorm:"column:replica" json:"replica" form:"replica"`
 	Node          string    `gorm:"column:node" json:"node" form:"node"`
 	Pid           int       `gorm:"column:pid" json:"pid" form:"pid"`
+	ProcStartTime int64     `gorm:"column:proc_start_time" json:"proc_start_time" form:"proc_start_time"`
 	Cmd           string    `gorm:"column:cmd" json:"cmd" form:"cmd"`
 	Args          string    `gorm:"column:args" json:"args" form:"args"`
 	Outfile       string    `gorm:"column:outfile" json:"outfile" form:"outfile"`
@@ -15,11 +19,15 @@ type Task struct {
 	Ip            string    `gorm:"column:ip" json:"ip" form:"ip"`
 	BigOne        string    `gorm:"column:big_one" json:"big_one" form:"big_one"`
 	Type          string    `gorm:"column:type" json:"type" form:"type"`
+	Spec          string    `gorm:"column:spec" json:"spec" form:"spec"`
 	LoadMethod    string    `gorm:"column:load_method" json:"load_method" form:"load_method"`
 	DoOnce        int64     `gorm:"column:do_once" json:"do_once" form:"do_once"`
 	Status        int64     `gorm:"column:status" json:"status" form:"status"`
 	RetryCount    int64     `gorm:"column:retry_count" json:"retry_count" form:"retry_count"`
 	LastError     string    `gorm:"column:last_error" json:"last_error" form:"last_error"`
+	Outcome       string    `gorm:"column:outcome" json:"outcome" form:"outcome"`
+	Health        string    `gorm:"column:health" json:"health" form:"health"`
+	Movable       int64     `gorm:"column:movable" json:"movable" form:"movable"`
 	HeartBeatTime time.Time `gorm:"column:heart_beat_time" json:"heart_beat_time" form:"heart_beat_time"`
 	CreateTime    time.Time `gorm:"column:create_time" json:"create_time" form:"create_time"`
 	UpdateTime    time.Time `gorm:"column:update_time" json:"update_time" form:"update_time"`
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// TaskEvent 任务生命周期事件, 如故障转移
+type TaskEvent struct {
+	ID         int64     `gorm:"column:id" json:"id" form:"id"`
+	JobId      string    `gorm:"column:job_id" json:"job_id" form:"job_id"`
+	Type       string    `gorm:"column:type" json:"type" form:"type"`
+	FromNode   string    `gorm:"column:from_node" json:"from_node" form:"from_node"`
+	ToNode     string    `gorm:"column:to_node" json:"to_node" form:"to_node"`
+	Message    string    `gorm:"column:message" json:"message" form:"message"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time" form:"create_time"`
+}
+
+func (e *TaskEvent) TableName() string {
+	return "task_event"
+}
@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+// Workflow 按依赖关系依次启动的一组任务
+type Workflow struct {
+	ID         int64      `gorm:"column:id" json:"id" form:"id"`
+	WorkflowId string     `gorm:"column:workflow_id" json:"workflow_id" form:"workflow_id"`
+	Name       string     `gorm:"column:name" json:"name" form:"name"`
+	Status     int64      `gorm:"column:status" json:"status" form:"status"`
+	LastError  string     `gorm:"column:last_error" json:"last_error" form:"last_error"`
+	EndTime    *time.Time `gorm:"column:end_time" json:"end_time" form:"end_time"`
+	CreateTime time.Time  `gorm:"column:create_time" json:"create_time" form:"create_time"`
+	UpdateTime time.Time  `gorm:"column:update_time" json:"update_time" form:"update_time"`
+}
+
+func (w *Workflow) TableName() string {
+	return "workflow"
+}
+
+// WorkflowStep 工作流中的一个步骤, 启动后 job_id 为创建的任务 ID(doOnce 为执行 ID)
+type WorkflowStep struct {
+	ID         int64      `gorm:"column:id" json:"id" form:"id"`
+	WorkflowId string     `gorm:"column:workflow_id" json:"workflow_id" form:"workflow_id"`
+	Name       string     `gorm:"column:name" json:"name" form:"name"`
+	DependsOn  string     `gorm:"column:depends_on" json:"depends_on" form:"depends_on"`
+	OnFailure  string     `gorm:"column:on_failure" json:"on_failure" form:"on_failure"`
+	Spec       string     `gorm:"column:spec" json:"spec" form:"spec"`
+	Status     int64      `gorm:"column:status" json:"status" form:"status"`
+	JobId      string     `gorm:"column:job_id" json:"job_id" form:"job_id"`
+	LastError  string     `gorm:"column:last_error" json:"last_error" form:"last_error"`
+	StartTime  *time.Time `gorm:"column:start_time" json:"start_time" form:"start_time"`
+	EndTime    *time.Time `gorm:"column:end_time" json:"end_time" form:"end_time"`
+	CreateTime time.Time  `gorm:"column:create_time" json:"create_time" form:"create_time"`
+	UpdateTime time.Time  `gorm:"column:update_time" json:"update_time" form:"update_time"`
+}
+
+func (s *WorkflowStep) TableName() string {
+	return "workflow_step"
+}
@@ -3,10 +3,13 @@ package handler
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"wsystemd/cmd/cluster"
 	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/middlewares"
 	"wsystemd/cmd/http/params"
 	"wsystemd/cmd/http/service"
 	"wsystemd/cmd/utils"
+	"wsystemd/cmd/workflow"
 )
 
 // StartJob 开启任务
@@ -23,10 +26,23 @@ func StartJob(ctx *gin.Context) {
 		res      interface{}
 		codeType *utils.CodeType
 	)
+	if req.SubmitAt != "" && req.Delay > 0 {
+		utils.MessageError(ctx, "submitAt delay 只能填写一个")
+		return
+	}
 	if req.LoadMethod == "" {
 		req.LoadMethod = consts.Load_Method_HASH
 	}
-	res, codeType = service.CreateClusterModeJob(req)
+	// 副本信息只能由分发副本的节点填充
+	if !middlewares.IsForwarded(ctx) {
+		clearInternal(&req)
+	}
+	// 其他节点转发的请求已完成调度, 直接在本节点启动, 避免再次调度转发
+	if middlewares.IsForwarded(ctx) {
+		res, codeType = service.CreateJobLocal(req)
+	} else {
+		res, codeType = service.SubmitJob(req)
+	}
 	if codeType.Code != 0 {
 		utils.Error(ctx, codeType)
 		return
@@ -44,7 +60,11 @@ func StopJob(ctx *gin.Context) {
 	var (
 		codeType *utils.CodeType
 	)
-	codeType = service.StopSingleModeJob(jobId, true)
+	if middlewares.IsForwarded(ctx) {
+		codeType = service.StopJobLocal(jobId, true)
+	} else {
+		codeType = service.StopSingleModeJob(jobId, true)
+	}
 	if codeType.Code != 0 {
 		utils.Error(ctx, codeType)
 		return
@@ -53,6 +73,36 @@ func StopJob(ctx *gin.Context) {
 	return
 }
 
+// AdoptJob 故障转移时由其他节点调用, 在本节点拉起任务
+func AdoptJob(ctx *gin.Context) {
+	jobId := ctx.Param("id")
+	if jobId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	res, codeType := service.AdoptJob(jobId)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// ReleaseJob rebalance 时由 leader 调用, 停止已迁出本节点的任务进程
+func ReleaseJob(ctx *gin.Context) {
+	jobId := ctx.Param("id")
+	if jobId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	res, codeType := service.ReleaseJob(jobId)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
 func StopBigOne(ctx *gin.Context) {
 	var (
 		vd  = utils.NewValidator()
@@ -62,7 +112,12 @@ func StopBigOne(ctx *gin.Context) {
 		utils.MessageError(ctx, errMsg)
 		return
 	}
-	codeType := service.StopBigOne(req)
+	var codeType *utils.CodeType
+	if middlewares.IsForwarded(ctx) {
+		codeType = service.StopBigOneLocal(req)
+	} else {
+		codeType = service.StopBigOne(req)
+	}
 	if codeType.Code != 0 {
 		utils.Error(ctx, codeType)
 		return
@@ -84,7 +139,11 @@ func ReportJob(ctx *gin.Context) {
 	var (
 		codeType *utils.CodeType
 	)
-	codeType = service.SingleJobReporter(req)
+	if middlewares.IsForwarded(ctx) {
+		codeType = service.ReportJobLocal(req)
+	} else {
+		codeType = service.SingleJobReporter(req)
+	}
 	if codeType.Code != 0 {
 		utils.Error(ctx, codeType)
 		return
@@ -94,12 +153,439 @@ func ReportJob(ctx *gin.Context) {
 
 // JobList 任务列表
 func JobList(ctx *gin.Context) {
-
+	var (
+		vd  = utils.NewValidator()
+		req = params.JobList{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.JobList(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
 }
 
 // JobInfo 任务详情
 func JobInfo(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.JobInfo{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	var (
+		res      interface{}
+		codeType *utils.CodeType
+	)
+	if middlewares.IsForwarded(ctx) {
+		res, codeType = service.JobInfoLocal(req)
+	} else {
+		res, codeType = service.JobInfo(req)
+	}
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// ScaleService 调整多副本任务的副本数
+func ScaleService(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.ServiceScale{}
+	)
+	serviceId := ctx.Param("id")
+	if serviceId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.ScaleService(serviceId, req.Num)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// StopService 停止多副本任务的全部副本
+func StopService(ctx *gin.Context) {
+	serviceId := ctx.Param("id")
+	if serviceId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	codeType := service.StopService(serviceId)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Success(ctx)
+}
+
+// ServiceInfo 多副本任务详情
+func ServiceInfo(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.ServiceInfo{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.ServiceInfo(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// ClusterLeader 当前 leader 及任期
+func ClusterLeader(ctx *gin.Context) {
+	res, codeType := service.ClusterLeader()
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// ClusterWorkers 集群节点列表
+func ClusterWorkers(ctx *gin.Context) {
+	res, codeType := service.ClusterWorkers()
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// RebalancePlan 按当前负载计算的迁移计划, 不执行
+func RebalancePlan(ctx *gin.Context) {
+	res, codeType := service.RebalancePlan()
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// CordonWorker 节点不再接收新任务
+func CordonWorker(ctx *gin.Context) {
+	setWorkerState(ctx, cluster.WorkerCordoned)
+}
+
+// UncordonWorker 节点恢复调度, 同时停止正在进行的迁移
+func UncordonWorker(ctx *gin.Context) {
+	setWorkerState(ctx, cluster.WorkerActive)
+}
+
+// DrainWorker 节点不再接收新任务并迁出现有任务
+func DrainWorker(ctx *gin.Context) {
+	setWorkerState(ctx, cluster.WorkerDraining)
+}
 
+func setWorkerState(ctx *gin.Context, state string) {
+	node := ctx.Param("node")
+	if node == "" {
+		utils.MessageError(ctx, "node 不能为空")
+		return
+	}
+	res, codeType := service.SetWorkerState(node, state)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// DrainStatus 节点迁移进度
+func DrainStatus(ctx *gin.Context) {
+	node := ctx.Param("node")
+	if node == "" {
+		utils.MessageError(ctx, "node 不能为空")
+		return
+	}
+	res, codeType := service.DrainStatus(node)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// ExecutionList 一次性任务执行列表
+func ExecutionList(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.ExecutionList{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.ExecutionList(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// ExecutionInfo 一次性任务执行结果, 可等待执行结束
+func ExecutionInfo(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.ExecutionInfo{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.ExecutionInfo(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// CreateTimer 创建定时任务
+func CreateTimer(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.TimerCfg{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	if errMsg := checkTimerParam(req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	if req.Job.LoadMethod == "" {
+		req.Job.LoadMethod = consts.Load_Method_HASH
+	}
+	clearInternal(&req.Job)
+	res, codeType := service.CreateTimer(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// TimerList 定时任务列表
+func TimerList(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.TimerList{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.TimerList(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// TimerInfo 定时任务详情
+func TimerInfo(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.TimerInfo{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.TimerInfo(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// PauseTimer 暂停定时任务
+func PauseTimer(ctx *gin.Context) {
+	timerAction(ctx, service.PauseTimer)
+}
+
+// ResumeTimer 恢复定时任务
+func ResumeTimer(ctx *gin.Context) {
+	timerAction(ctx, service.ResumeTimer)
+}
+
+// StopTimer 删除定时任务
+func StopTimer(ctx *gin.Context) {
+	timerAction(ctx, service.StopTimer)
+}
+
+func timerAction(ctx *gin.Context, action func(timerId string) *utils.CodeType) {
+	timerId := ctx.Param("id")
+	if timerId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	codeType := action(timerId)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Success(ctx)
+}
+
+// CreateWorkflow 提交工作流
+func CreateWorkflow(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.WorkflowCfg{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	if errMsg := checkWorkflowParam(req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	for i := range req.Steps {
+		if req.Steps[i].Job.LoadMethod == "" {
+			req.Steps[i].Job.LoadMethod = consts.Load_Method_HASH
+		}
+		clearInternal(&req.Steps[i].Job)
+	}
+	res, codeType := service.CreateWorkflow(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// WorkflowList 工作流列表
+func WorkflowList(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.WorkflowList{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.WorkflowList(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// WorkflowInfo 工作流详情
+func WorkflowInfo(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.WorkflowInfo{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.WorkflowInfo(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// CancelWorkflow 取消工作流
+func CancelWorkflow(ctx *gin.Context) {
+	workflowId := ctx.Param("id")
+	if workflowId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	codeType := service.CancelWorkflow(workflowId)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Success(ctx)
+}
+
+// PendingList 待提交任务列表
+func PendingList(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.PendingList{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.PendingList(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// PendingInfo 待提交任务详情
+func PendingInfo(ctx *gin.Context) {
+	var (
+		vd  = utils.NewValidator()
+		req = params.PendingInfo{}
+	)
+	if errMsg := vd.ParseJson(ctx, &req); errMsg != "" {
+		utils.MessageError(ctx, errMsg)
+		return
+	}
+	res, codeType := service.PendingInfo(req)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Out(ctx, res)
+}
+
+// CancelPending 取消待提交任务
+func CancelPending(ctx *gin.Context) {
+	pendingId := ctx.Param("id")
+	if pendingId == "" {
+		utils.MessageError(ctx, "id 不能为空")
+		return
+	}
+	codeType := service.CancelPending(pendingId)
+	if codeType.Code != 0 {
+		utils.Error(ctx, codeType)
+		return
+	}
+	utils.Success(ctx)
+}
+
+// clearInternal 清除服务端内部填充的字段, 外部请求不能指定
+func clearInternal(req *params.JobCfg) {
+	req.ParentId = ""
+	req.Replica = 0
 }
 
 func checkParam(req params.JobCfg) string {
@@ -108,3 +594,31 @@ func checkParam(req params.JobCfg) string {
 	}
 	return ""
 }
+
+func checkTimerParam(req params.TimerCfg) string {
+	set := 0
+	for _, ok := range []bool{req.Cron != "", req.Interval > 0, req.RunAt != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return "cron interval runAt 必须且只能填写一个"
+	}
+	if req.Job.Num > 1 {
+		return "定时任务不支持多副本"
+	}
+	return ""
+}
+
+func checkWorkflowParam(req params.WorkflowCfg) string {
+	for _, step := range req.Steps {
+		if step.Job.Num > 1 {
+			return "工作流步骤不支持多副本"
+		}
+	}
+	if err := workflow.Validate(service.WorkflowSteps(req)); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,294 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/log/level"
+	"github.com/golang-jwt/jwt/v5"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+)
+
+// 角色权限依次递增: viewer 只读, operator 提交/停止任务, admin 节点管理
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleLevel = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+const identityKey = "identity"
+
+// Identity 认证通过的调用方
+type Identity struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Method string `json:"method"`
+}
+
+type TokenConfig struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token"`
+	Role  string `mapstructure:"role"`
+}
+
+// JwtConfig alg 为 HS256/HS384/HS512 时使用 secret, RS256/RS384/RS512 时使用 publicKeyFile
+type JwtConfig struct {
+	Alg           string `mapstructure:"alg"`
+	Secret        string `mapstructure:"secret"`
+	PublicKeyFile string `mapstructure:"publickeyfile"`
+	Issuer        string `mapstructure:"issuer"`
+	Audience      string `mapstructure:"audience"`
+	// 角色所在的 claim, 默认 role
+	RoleClaim string `mapstructure:"roleclaim"`
+}
+
+type AuthConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Tokens  []TokenConfig `mapstructure:"tokens"`
+	Jwt     *JwtConfig    `mapstructure:"jwt"`
+	// 客户端证书 CN 对应的角色, 需要开启 tls 并配置 caFile
+	CertRoles map[string]string `mapstructure:"certroles"`
+}
+
+// Authenticator 认证方式, 请求未携带该方式的凭证时返回 nil, nil
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*Identity, error)
+}
+
+var (
+	authConfig     *AuthConfig
+	authenticators []Authenticator
+	authOnce       sync.Once
+	authErr        error
+)
+
+// GetAuthConfig 读取 auth 配置, 未配置时不开启认证
+func GetAuthConfig() *AuthConfig {
+	initAuth()
+	return authConfig
+}
+
+// InitAuth 按配置创建认证方式, 配置错误时返回错误
+func InitAuth() error {
+	initAuth()
+	return authErr
+}
+
+func initAuth() {
+	authOnce.Do(func() {
+		authConfig = &AuthConfig{}
+		if conf, err := core.GetSingleConfig(core.CoreConfig, "auth", AuthConfig{}); err == nil {
+			authConfig = conf.(*AuthConfig)
+		}
+		authenticators, authErr = NewAuthenticators(authConfig)
+	})
+}
+
+// NewAuthenticators 依次尝试客户端证书、静态 token、JWT
+// 示例配置中的占位值, 不允许直接使用
+const placeholderSecret = "change-me"
+
+func NewAuthenticators(conf *AuthConfig) ([]Authenticator, error) {
+	var list []Authenticator
+	if len(conf.CertRoles) > 0 {
+		for cn, role := range conf.CertRoles {
+			if _, ok := roleLevel[role]; !ok {
+				return nil, fmt.Errorf("invalid role %q for cert %s", role, cn)
+			}
+		}
+		list = append(list, certAuth{roles: conf.CertRoles})
+	}
+	if len(conf.Tokens) > 0 {
+		tokens := make([]TokenConfig, 0, len(conf.Tokens))
+		for _, token := range conf.Tokens {
+			if token.Token == "" {
+				return nil, fmt.Errorf("empty token for %s", token.Name)
+			}
+			if token.Token == placeholderSecret {
+				return nil, fmt.Errorf("placeholder token for %s, set a random token", token.Name)
+			}
+			if _, ok := roleLevel[token.Role]; !ok {
+				return nil, fmt.Errorf("invalid role %q for token %s", token.Role, token.Name)
+			}
+			tokens = append(tokens, token)
+		}
+		list = append(list, tokenAuth{tokens: tokens})
+	}
+	if conf.Jwt != nil {
+		auth, err := newJwtAuth(conf.Jwt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, auth)
+	}
+	return list, nil
+}
+
+// Authenticate 识别调用方身份, 具体权限由路由上的 RequireRole 校验
+// 未开启认证时所有请求视为 admin; 校验通过的节点间转发请求视为 admin, 权限已在首个节点校验
+func Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf := GetAuthConfig()
+		if !conf.Enabled {
+			c.Set(identityKey, &Identity{Name: "anonymous", Role: RoleAdmin})
+			c.Next()
+			return
+		}
+		if IsForwarded(c) {
+			c.Set(identityKey, &Identity{Name: c.GetString(forwardedKey), Role: RoleAdmin, Method: "worker"})
+			c.Next()
+			return
+		}
+
+		for _, auth := range authenticators {
+			identity, err := auth.Authenticate(c)
+			if err != nil {
+				level.Warn(log.Logger).Log("msg", "Authenticate fail", "clientIP", c.ClientIP(), "path", c.Request.URL.Path, "err", err)
+				utils.Error(c, utils.Unauthorized)
+				return
+			}
+			if identity != nil {
+				c.Set(identityKey, identity)
+				c.Next()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireRole 路由所需的最低角色
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := CurrentIdentity(c)
+		if identity == nil {
+			utils.Error(c, utils.Unauthorized)
+			return
+		}
+		if roleLevel[identity.Role] < roleLevel[role] {
+			level.Warn(log.Logger).Log("msg", "Permission denied", "name", identity.Name, "role", identity.Role,
+				"require", role, "path", c.Request.URL.Path)
+			utils.Error(c, utils.Forbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+func CurrentIdentity(c *gin.Context) *Identity {
+	if v, ok := c.Get(identityKey); ok {
+		return v.(*Identity)
+	}
+	return nil
+}
+
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return c.GetHeader("X-Token")
+}
+
+type tokenAuth struct {
+	tokens []TokenConfig
+}
+
+func (a tokenAuth) Authenticate(c *gin.Context) (*Identity, error) {
+	token := bearerToken(c)
+	if token == "" {
+		return nil, nil
+	}
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return &Identity{Name: t.Name, Role: t.Role, Method: "token"}, nil
+		}
+	}
+	// 可能是 JWT, 交给后续认证方式
+	return nil, nil
+}
+
+type jwtAuth struct {
+	conf    *JwtConfig
+	key     interface{}
+	options []jwt.ParserOption
+}
+
+func newJwtAuth(conf *JwtConfig) (*jwtAuth, error) {
+	auth := &jwtAuth{conf: conf}
+	if conf.RoleClaim == "" {
+		conf.RoleClaim = "role"
+	}
+	switch conf.Alg {
+	case "HS256", "HS384", "HS512":
+		if conf.Secret == "" {
+			return nil, fmt.Errorf("jwt secret is required for %s", conf.Alg)
+		}
+		if conf.Secret == placeholderSecret {
+			return nil, fmt.Errorf("placeholder jwt secret, set a random secret")
+		}
+		auth.key = []byte(conf.Secret)
+	case "RS256", "RS384", "RS512":
+		pem, err := os.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read jwt public key: %v", err)
+		}
+		if auth.key, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("parse jwt public key: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt alg %q", conf.Alg)
+	}
+
+	auth.options = []jwt.ParserOption{jwt.WithValidMethods([]string{conf.Alg}), jwt.WithExpirationRequired()}
+	if conf.Issuer != "" {
+		auth.options = append(auth.options, jwt.WithIssuer(conf.Issuer))
+	}
+	if conf.Audience != "" {
+		auth.options = append(auth.options, jwt.WithAudience(conf.Audience))
+	}
+	return auth, nil
+}
+
+func (a *jwtAuth) Authenticate(c *gin.Context) (*Identity, error) {
+	raw := bearerToken(c)
+	if strings.Count(raw, ".") != 2 {
+		return nil, nil
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(raw, claims, func(*jwt.Token) (interface{}, error) { return a.key, nil }, a.options...); err != nil {
+		return nil, err
+	}
+	role, _ := claims[a.conf.RoleClaim].(string)
+	if _, ok := roleLevel[role]; !ok {
+		return nil, fmt.Errorf("invalid role %q in jwt", role)
+	}
+	name, _ := claims.GetSubject()
+	return &Identity{Name: name, Role: role, Method: "jwt"}, nil
+}
+
+// certAuth 按已校验的客户端证书 CN 映射角色
+type certAuth struct {
+	roles map[string]string
+}
+
+func (a certAuth) Authenticate(c *gin.Context) (*Identity, error) {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cn := state.VerifiedChains[0][0].Subject.CommonName
+	role, ok := a.roles[cn]
+	if !ok {
+		// 没有映射的证书(如其他节点的证书)交给后续认证方式
+		return nil, nil
+	}
+	return &Identity{Name: cn, Role: role, Method: "cert"}, nil
+}
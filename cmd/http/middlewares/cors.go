@@ -3,47 +3,74 @@ package middlewares
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"sync"
+	"wsystemd/cmd/http/core"
 )
 
+// CorsConfig 允许跨域访问的来源, "*" 表示允许任意来源但不携带凭证
+type CorsConfig struct {
+	AllowOrigins []string `mapstructure:"alloworigins"`
+}
+
+var (
+	corsConfig     *CorsConfig
+	corsConfigOnce sync.Once
+)
+
+func GetCorsConfig() *CorsConfig {
+	corsConfigOnce.Do(func() {
+		corsConfig = &CorsConfig{}
+		if conf, err := core.GetSingleConfig(core.CoreConfig, "cors", CorsConfig{}); err == nil {
+			corsConfig = conf.(*CorsConfig)
+		}
+	})
+	return corsConfig
+}
+
+// allow 返回是否允许该来源及是否允许携带凭证, 只有明确配置的来源允许携带凭证
+func (c *CorsConfig) allow(origin string) (bool, bool) {
+	wildcard := false
+	for _, o := range c.AllowOrigins {
+		if o == origin {
+			return true, true
+		}
+		if o == "*" {
+			wildcard = true
+		}
+	}
+	return wildcard, false
+}
+
 func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		method := c.Request.Method
-		keys := "x-token, X-Token,Authorization,content-type"
-		for k, _ := range c.Request.Header {
-			if keys != "" {
-				keys = keys + ", " + k
-			} else {
-				keys += k
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		allowed, credentials := GetCorsConfig().allow(origin)
+		if !allowed {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
 			}
+			c.Next()
+			return
 		}
-		c.Header("Access-Control-Allow-Origin", c.Request.Header.Get("Origin"))
+
+		c.Header("Vary", "Origin")
+		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		c.Header("Access-Control-Allow-Headers", keys)
-		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Access-Control-Allow-Headers", "Authorization, X-Token, Content-Type")
+		if credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
 		c.Header("Access-Control-Max-Age", "86400")
 		// 放行所有OPTIONS方法
-		if method == "OPTIONS" {
+		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
+			return
 		}
 		c.Next()
 	}
 }
-
-/*
-func CorsHandler() gin.HandlerFunc {
-	return func(context *gin.Context) {
-		context.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		context.Header("Access-Control-Allow-Methods", "*")
-		context.Header("Access-Control-Allow-Headers", "*")
-		context.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers,Cache-Control,Content-Language,Content-Type,Expires,Last-Modified,Pragma,FooBar") // 跨域关键设置 让浏览器可以解析
-		context.Header("Access-Control-Max-Age", "172800")                                                                                                                                                           // 缓存请求信息 单位为秒
-		context.Header("Access-Control-Allow-Credentials", "false")                                                                                                                                                  //  跨域请求是否需要带cookie信息 默认设置为true
-		context.Header("content-type", "application/json")                                                                                                                                                           // 设置返回格式是json
-		//Release all option pre-requests
-		if context.Request.Method == http.MethodOptions {
-			context.JSON(http.StatusOK, "Options Request!")
-		}
-		context.Next()
-	}
-}
-*/
@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/log/level"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+)
+
+const forwardedKey = "forwardedFrom"
+
+// RpcVersion 拒绝协议版本不一致的节点间请求, 不带版本头的外部请求不受影响
+func RpcVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if version := c.GetHeader(cluster.RpcVersionHeader); version != "" && version != cluster.RpcVersion {
+			utils.Error(c, utils.RpcVersionErr)
+			return
+		}
+		c.Next()
+	}
+}
+
+// WorkerAuth 校验其他节点转发的请求, 签名有效或对端出示了集群节点的证书时标记为转发请求, 由本节点直接处理不再调度
+func WorkerAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(cluster.ForwardedHeader) == "" && c.GetHeader(cluster.SignatureHeader) == "" {
+			c.Next()
+			return
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		conf := cluster.GetRpcConfig()
+		node, err := cluster.VerifyRequest(c.Request, body, conf.Secret, conf.MaxSkew)
+		if peer := peerWorker(c); err != nil && peer != "" && peer == c.GetHeader(cluster.ForwardedHeader) {
+			node, err = peer, nil
+		}
+		if err != nil {
+			level.Warn(log.Logger).Log("msg", "Worker auth fail", "clientIP", c.ClientIP(), "path", c.Request.URL.Path, "err", err)
+			utils.Error(c, utils.WorkerAuthErr)
+			return
+		}
+		c.Set(forwardedKey, node)
+		c.Next()
+	}
+}
+
+// RequireWorker 只允许其他节点调用的内部接口, 集群模式下必须是校验通过的转发请求, 单机模式需要 admin 权限
+func RequireWorker() gin.HandlerFunc {
+	requireAdmin := RequireRole(RoleAdmin)
+	return func(c *gin.Context) {
+		if IsForwarded(c) {
+			c.Next()
+			return
+		}
+		if cluster.WkMg == nil {
+			requireAdmin(c)
+			return
+		}
+		utils.Error(c, utils.WorkerAuthErr)
+	}
+}
+
+// peerWorker 对端出示了经 tls.caFile 校验的证书且 CN 为集群中的节点主机名时, 返回该节点
+func peerWorker(c *gin.Context) string {
+	state := c.Request.TLS
+	if cluster.WkMg == nil || state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cn := state.VerifiedChains[0][0].Subject.CommonName
+	if _, ok := cluster.WkMg.View().Get(cn); !ok {
+		return ""
+	}
+	return cn
+}
+
+// IsForwarded 请求是否由其他节点转发
+func IsForwarded(c *gin.Context) bool {
+	node, ok := c.Get(forwardedKey)
+	return ok && node.(string) != ""
+}
@@ -0,0 +1,61 @@
+package params
+
+import "strings"
+
+// 旧版本不校验 restart/loadMethod, 兼容常见的写法
+var (
+	restartAliases = map[string]string{
+		"never":          "no",
+		"none":           "no",
+		"on_failure":     "on-failure",
+		"on_abnormal":    "on-abnormal",
+		"unless_stopped": "unless-stopped",
+	}
+	loadMethodAliases = map[string]string{
+		"rr":          "round_robin",
+		"roundrobin":  "round_robin",
+		"round-robin": "round_robin",
+	}
+)
+
+// Normalize 校验前统一取值: 不区分大小写, 兼容别名, 未填写类型的健康检查按字段推断
+func (j *JobCfg) Normalize() {
+	j.Restart = normalizeValue(j.Restart, restartAliases)
+	j.LoadMethod = normalizeValue(j.LoadMethod, loadMethodAliases)
+	for i := range j.Checks {
+		j.Checks[i].normalize()
+	}
+}
+
+func (c *JobCheck) normalize() {
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	if c.Type != "" {
+		return
+	}
+	switch {
+	case c.Cmd != "":
+		c.Type = "cmd"
+	case strings.HasPrefix(c.Api, "http://") || strings.HasPrefix(c.Api, "https://"):
+		c.Type = "http"
+	case c.Api != "":
+		c.Type = "tcp"
+	}
+}
+
+func (t *TimerCfg) Normalize() {
+	t.Job.Normalize()
+}
+
+func (w *WorkflowCfg) Normalize() {
+	for i := range w.Steps {
+		w.Steps[i].Job.Normalize()
+	}
+}
+
+func normalizeValue(v string, aliases map[string]string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if alias, ok := aliases[v]; ok {
+		return alias
+	}
+	return v
+}
@@ -8,32 +8,65 @@ type JobRun struct {
 	Errfile string   `json:"errfile" validate:"required,min=1"`
 }
 
+// JobCheck 健康检查, type: http(GET api)/cmd(执行 cmd args)/tcp(连接 api, 格式 host:port)
 type JobCheck struct {
-	Type     string   `json:"type" validate:"omitempty"`
-	Api      string   `json:"api" validate:"omitempty"`
-	Cmd      string   `json:"cmd" validate:"omitempty"`
+	Type     string   `json:"type" validate:"required,oneof=http cmd tcp"`
+	Api      string   `json:"api" validate:"required_unless=Type cmd"`
+	Cmd      string   `json:"cmd" validate:"required_if=Type cmd"`
 	Args     []string `json:"args" validate:"omitempty"`
-	Interval int      `json:"interval" validate:"omitempty"`
-	FailNum  int      `json:"failNum" validate:"omitempty"`
+	Interval int      `json:"interval" validate:"omitempty,min=0"`
+	FailNum  int      `json:"failNum" validate:"omitempty,min=0"`
+	Timeout  int      `json:"timeout" validate:"omitempty,min=0"`
 }
 
 type JobCfg struct {
 	Type      string     `json:"type" validate:"omitempty"`
-	Num       int        `json:"num" validate:"omitempty"`
-	Checks    []JobCheck `json:"checks" validate:"omitempty"`
+	Num       int        `json:"num" validate:"omitempty,min=0,max=1000"`
+	Checks    []JobCheck `json:"checks" validate:"omitempty,dive"`
 	FailCodes []int      `json:"failCodes" validate:"omitempty"`
+	// 视为正常退出的退出码 / 不触发重启的退出码
+	SuccessCodes        []int `json:"successCodes" validate:"omitempty"`
+	PreventRestartCodes []int `json:"preventRestartCodes" validate:"omitempty"`
 
 	// 新版本需要的参数
 	DoOnce     bool   `json:"doOnce" validate:"omitempty"`
 	Run        JobRun `json:"run" validate:"required"`
-	Restart    string `json:"restart" validate:"omitempty"`
+	Restart    string `json:"restart" validate:"omitempty,oneof=no always on-failure on-abnormal unless-stopped"`
 	Node       string `json:"node" validate:"omitempty"`
 	Dc         string `json:"dc" validate:"omitempty"`
 	Ip         string `json:"ip" validate:"omitempty"`
-	LoadMethod string `json:"loadMethod" validate:"omitempty"`
+	LoadMethod string `json:"loadMethod" validate:"omitempty,oneof=round_robin hash cpu load weighted"`
+	// 节点标签选择, 只调度到 labels 全部匹配的节点
+	Selector map[string]string `json:"selector" validate:"omitempty"`
+	// 是否允许 rebalance 迁移到其他节点, 不填默认允许
+	Movable *bool `json:"movable" validate:"omitempty"`
 
 	BigOne      string `json:"bigOne" validate:"omitempty"`
 	BigOneJobId string `json:"bigOneJobId" validate:"omitempty"`
+
+	// 多副本任务分发副本时由服务端填充, 外部请求中的值会被忽略, 只接受节点间转发请求中的值
+	ParentId string `json:"parentId" validate:"omitempty"`
+	Replica  int    `json:"replica" validate:"omitempty,min=0"`
+
+	// doOnce 任务的执行超时, 单位秒, 不填使用 execution.timeout; bigOne 任务不填时不限制
+	Timeout int `json:"timeout" validate:"omitempty,min=0"`
+	// 常驻任务的最长运行时间, 单位秒, 0 不限制, 同 systemd RuntimeMaxSec
+	MaxRuntime int `json:"maxRuntime" validate:"omitempty,min=0"`
+	// 停止或超时终止时发送的信号, 默认 SIGTERM, 等待 stopGrace 秒后仍未退出则 SIGKILL
+	StopSignal string `json:"stopSignal" validate:"omitempty,oneof=SIGTERM SIGINT SIGQUIT SIGHUP SIGUSR1 SIGUSR2 SIGKILL"`
+	StopGrace  int    `json:"stopGrace" validate:"omitempty,min=0"`
+
+	// 延迟提交, submitAt 与 delay(秒)二选一, 到期前在待提交队列中等待
+	SubmitAt string `json:"submitAt" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	Delay    int    `json:"delay" validate:"omitempty,min=0"`
+	// 待提交队列中的优先级, 默认 normal
+	Priority string `json:"priority" validate:"omitempty,oneof=high normal low"`
+
+	// 重启策略参数, 单位秒, 不填使用默认值
+	RestartSec         int `json:"restartSec" validate:"omitempty,min=0"`
+	RestartMaxSec      int `json:"restartMaxSec" validate:"omitempty,min=0"`
+	StartLimitBurst    int `json:"startLimitBurst" validate:"omitempty,min=0"`
+	StartLimitInterval int `json:"startLimitInterval" validate:"omitempty,min=0"`
 }
 
 type JobReporter struct {
@@ -44,3 +77,98 @@ type JobReporter struct {
 type BigOne struct {
 	BigOneJobId string `json:"bigOneJobId" validate:"required"`
 }
+
+type JobList struct {
+	Node      string `json:"node" validate:"omitempty"`
+	Dc        string `json:"dc" validate:"omitempty"`
+	Ip        string `json:"ip" validate:"omitempty"`
+	Status    *int64 `json:"status" validate:"omitempty,oneof=0 1 2"`
+	DoOnce    *bool  `json:"doOnce" validate:"omitempty"`
+	BigOne    *bool  `json:"bigOne" validate:"omitempty"`
+	StartTime string `json:"startTime" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	EndTime   string `json:"endTime" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	Cursor    int64  `json:"cursor" validate:"omitempty,min=0"`
+	Limit     int    `json:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+type JobInfo struct {
+	JobId string `json:"jobId" validate:"required"`
+}
+
+type ServiceScale struct {
+	Num int `json:"num" validate:"min=0,max=1000"`
+}
+
+type ServiceInfo struct {
+	ServiceId string `json:"serviceId" validate:"required"`
+}
+
+// TimerCfg 定时任务, cron/interval/runAt 三选一
+type TimerCfg struct {
+	Name string `json:"name" validate:"omitempty,max=255"`
+	// cron 表达式, 支持可选的秒字段及 @daily/@every 1h 等描述符
+	Cron string `json:"cron" validate:"omitempty"`
+	// 固定间隔, 单位秒
+	Interval int `json:"interval" validate:"omitempty,min=1"`
+	// 指定时间执行一次
+	RunAt       string `json:"runAt" validate:"omitempty,datetime=2006-01-02 15:04:05"`
+	Missed      string `json:"missed" validate:"omitempty,oneof=skip once catchup"`
+	Concurrency string `json:"concurrency" validate:"omitempty,oneof=allow forbid replace"`
+	Job         JobCfg `json:"job" validate:"required"`
+}
+
+type TimerList struct {
+	Cursor int64 `json:"cursor" validate:"omitempty,min=0"`
+	Limit  int   `json:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+type TimerInfo struct {
+	TimerId string `json:"timerId" validate:"required"`
+}
+
+type ExecutionList struct {
+	Node   string `json:"node" validate:"omitempty"`
+	Status *int64 `json:"status" validate:"omitempty,oneof=0 1 2 3"`
+	Cursor int64  `json:"cursor" validate:"omitempty,min=0"`
+	Limit  int    `json:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+// ExecutionInfo wait 大于 0 时等待执行结束, 最多 wait 秒
+type ExecutionInfo struct {
+	ExecId string `json:"execId" validate:"required"`
+	Wait   int    `json:"wait" validate:"omitempty,min=0,max=300"`
+}
+
+// WorkflowCfg 工作流, 步骤按 dependsOn 依赖关系启动, 不能有环
+type WorkflowCfg struct {
+	Name  string         `json:"name" validate:"omitempty,max=255"`
+	Steps []WorkflowStep `json:"steps" validate:"required,min=1,max=100,dive"`
+}
+
+type WorkflowStep struct {
+	Name      string   `json:"name" validate:"required,max=64"`
+	DependsOn []string `json:"dependsOn" validate:"omitempty"`
+	// 失败处理: fail(默认) 工作流失败, skip 跳过下游, continue 下游继续
+	OnFailure string `json:"onFailure" validate:"omitempty,oneof=fail skip continue"`
+	Job       JobCfg `json:"job" validate:"required"`
+}
+
+type WorkflowList struct {
+	Status *int64 `json:"status" validate:"omitempty,oneof=1 2 3 4"`
+	Cursor int64  `json:"cursor" validate:"omitempty,min=0"`
+	Limit  int    `json:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+type WorkflowInfo struct {
+	WorkflowId string `json:"workflowId" validate:"required"`
+}
+
+type PendingList struct {
+	Status *int64 `json:"status" validate:"omitempty,oneof=0 1 2 3 4"`
+	Cursor int64  `json:"cursor" validate:"omitempty,min=0"`
+	Limit  int    `json:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+type PendingInfo struct {
+	PendingId string `json:"pendingId" validate:"required"`
+}
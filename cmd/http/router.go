@@ -3,13 +3,41 @@ package http
 import (
 	"github.com/gin-gonic/gin"
 	"wsystemd/cmd/http/handler"
+	"wsystemd/cmd/http/middlewares"
 )
 
 func initRouter(engine *gin.Engine) {
-	engine.POST("/v1/jobs/submit", handler.StartJob)
-	engine.PUT("/v1/jobs/:id/stop", handler.StopJob)
-	engine.POST("/v1/jobs/stopBigOne", handler.StopBigOne)
+	engine.POST("/v1/jobs/submit", middlewares.RequireRole(middlewares.RoleOperator), handler.StartJob)
+	engine.PUT("/v1/jobs/:id/stop", middlewares.RequireRole(middlewares.RoleOperator), handler.StopJob)
+	engine.POST("/v1/jobs/:id/adopt", middlewares.RequireWorker(), handler.AdoptJob)
+	engine.POST("/v1/jobs/:id/release", middlewares.RequireWorker(), handler.ReleaseJob)
+	engine.POST("/v1/jobs/stopBigOne", middlewares.RequireRole(middlewares.RoleOperator), handler.StopBigOne)
 	engine.POST("/v1/agent/tasks/report", handler.ReportJob)
-	engine.POST("/v1/job/list", handler.JobList)
-	engine.POST("/v1/job/info", handler.JobInfo)
+	engine.POST("/v1/job/list", middlewares.RequireRole(middlewares.RoleViewer), handler.JobList)
+	engine.POST("/v1/job/info", middlewares.RequireRole(middlewares.RoleViewer), handler.JobInfo)
+	engine.POST("/v1/execution/list", middlewares.RequireRole(middlewares.RoleViewer), handler.ExecutionList)
+	engine.POST("/v1/execution/info", middlewares.RequireRole(middlewares.RoleViewer), handler.ExecutionInfo)
+	engine.POST("/v1/timers/submit", middlewares.RequireRole(middlewares.RoleOperator), handler.CreateTimer)
+	engine.PUT("/v1/timers/:id/pause", middlewares.RequireRole(middlewares.RoleOperator), handler.PauseTimer)
+	engine.PUT("/v1/timers/:id/resume", middlewares.RequireRole(middlewares.RoleOperator), handler.ResumeTimer)
+	engine.PUT("/v1/timers/:id/stop", middlewares.RequireRole(middlewares.RoleOperator), handler.StopTimer)
+	engine.POST("/v1/timer/list", middlewares.RequireRole(middlewares.RoleViewer), handler.TimerList)
+	engine.POST("/v1/timer/info", middlewares.RequireRole(middlewares.RoleViewer), handler.TimerInfo)
+	engine.POST("/v1/workflows/submit", middlewares.RequireRole(middlewares.RoleOperator), handler.CreateWorkflow)
+	engine.PUT("/v1/workflows/:id/cancel", middlewares.RequireRole(middlewares.RoleOperator), handler.CancelWorkflow)
+	engine.POST("/v1/workflow/list", middlewares.RequireRole(middlewares.RoleViewer), handler.WorkflowList)
+	engine.POST("/v1/workflow/info", middlewares.RequireRole(middlewares.RoleViewer), handler.WorkflowInfo)
+	engine.PUT("/v1/pendings/:id/cancel", middlewares.RequireRole(middlewares.RoleOperator), handler.CancelPending)
+	engine.POST("/v1/pending/list", middlewares.RequireRole(middlewares.RoleViewer), handler.PendingList)
+	engine.POST("/v1/pending/info", middlewares.RequireRole(middlewares.RoleViewer), handler.PendingInfo)
+	engine.PUT("/v1/services/:id/scale", middlewares.RequireRole(middlewares.RoleOperator), handler.ScaleService)
+	engine.PUT("/v1/services/:id/stop", middlewares.RequireRole(middlewares.RoleOperator), handler.StopService)
+	engine.POST("/v1/service/info", middlewares.RequireRole(middlewares.RoleViewer), handler.ServiceInfo)
+	engine.GET("/v1/cluster/leader", middlewares.RequireRole(middlewares.RoleViewer), handler.ClusterLeader)
+	engine.GET("/v1/cluster/workers", middlewares.RequireRole(middlewares.RoleViewer), handler.ClusterWorkers)
+	engine.GET("/v1/cluster/rebalance/plan", middlewares.RequireRole(middlewares.RoleViewer), handler.RebalancePlan)
+	engine.POST("/v1/workers/:node/cordon", middlewares.RequireRole(middlewares.RoleAdmin), handler.CordonWorker)
+	engine.POST("/v1/workers/:node/uncordon", middlewares.RequireRole(middlewares.RoleAdmin), handler.UncordonWorker)
+	engine.POST("/v1/workers/:node/drain", middlewares.RequireRole(middlewares.RoleAdmin), handler.DrainWorker)
+	engine.GET("/v1/workers/:node/drain", middlewares.RequireRole(middlewares.RoleViewer), handler.DrainStatus)
 }
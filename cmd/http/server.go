@@ -20,6 +20,9 @@ func SetupRouter() (*gin.Engine, []func(), error) {
 	if err := core.FetchCoreConfig(); err != nil {
 		return nil, nil, err
 	}
+	if err := middlewares.InitAuth(); err != nil {
+		return nil, nil, err
+	}
 	cleanFun = append(cleanFun, core.InitMysql())
 	gin.DefaultWriter = io.MultiWriter()
 	engine := gin.Default()
@@ -31,6 +34,9 @@ func SetupRouter() (*gin.Engine, []func(), error) {
 		c.Set("bodyMap", bodyMap)
 	})
 	engine.Use(middlewares.Cors())
+	engine.Use(middlewares.RpcVersion())
+	engine.Use(middlewares.WorkerAuth())
+	engine.Use(middlewares.Authenticate())
 	engine.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		if strings.Contains(param.Path, "/v1/agent/tasks/report") {
 			return ""
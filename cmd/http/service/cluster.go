@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// ClusterLeader 查询当前 leader, isLeader 表示处理请求的节点是否为 leader
+func ClusterLeader() (interface{}, *utils.CodeType) {
+	if cluster.WkMg == nil {
+		return nil, utils.NotClusterMode
+	}
+	leader, err := cluster.WkMg.GetLeader(context.Background())
+	if errors.Is(err, cluster.ErrNoLeader) {
+		return nil, utils.NoLeader
+	}
+	if err != nil {
+		level.Error(log.Logger).Log("GetLeader Err", err.Error())
+		return nil, utils.ServerErr
+	}
+	return map[string]interface{}{
+		"leader":   leader,
+		"isLeader": cluster.IsLeader(),
+	}, &utils.CodeType{}
+}
+
+// ClusterWorkers 本节点缓存的集群节点列表, stale 为 true 时表示与 etcd 的 watch 中断, 数据可能落后
+func ClusterWorkers() (interface{}, *utils.CodeType) {
+	if cluster.WkMg == nil {
+		return nil, utils.NotClusterMode
+	}
+	view := cluster.WkMg.View()
+	workers, err := view.Workers()
+	if err != nil {
+		level.Error(log.Logger).Log("Workers Err", err.Error())
+		return nil, utils.ServerErr
+	}
+	return map[string]interface{}{
+		"workers":  workers,
+		"stale":    view.Stale(),
+		"revision": view.Revision(),
+	}, &utils.CodeType{}
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	drainStatusJobLimit = 100
+	// 启动不足该时间的进程不检查归属
+	releaseGrace = time.Minute
+	// 迁移失败后的重试间隔, 指数退避
+	drainRetryMin = 5 * time.Second
+	drainRetryMax = 5 * time.Minute
+)
+
+// 节点状态对应的接口路径
+var stateActions = map[string]string{
+	cluster.WorkerActive:   "uncordon",
+	cluster.WorkerCordoned: "cordon",
+	cluster.WorkerDraining: "drain",
+}
+
+// 同一时间只运行一个迁移流程
+var draining int32
+
+// SetWorkerState 修改节点状态, 状态保存在节点自己的注册信息中, 非本节点时转发到目标节点
+func SetWorkerState(node, state string) (interface{}, *utils.CodeType) {
+	if cluster.WkMg == nil {
+		return nil, utils.NotClusterMode
+	}
+	localNode, err := process.GetHostName()
+	if err != nil {
+		level.Error(log.Logger).Log("GetHostName Err", err.Error())
+		return nil, utils.ServerErr
+	}
+
+	if node != localNode {
+		client, err := cluster.ClientFor(node)
+		if err != nil {
+			level.Error(log.Logger).Log("GetWorkerInfo Err", err.Error(), "node", node)
+			return nil, cluster.CodeOf(err)
+		}
+		response, err := client.SetState(context.Background(), stateActions[state])
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "SetState on worker err", "node", node, "err", err)
+			return nil, cluster.CodeOf(err)
+		}
+		return response, &utils.CodeType{}
+	}
+
+	if err = cluster.WkMg.SetState(state); err != nil {
+		level.Error(log.Logger).Log("SetState Err", err.Error(), "state", state)
+		return nil, utils.ServerErr
+	}
+	level.Info(log.Logger).Log("msg", "Worker state changed", "node", node, "state", state)
+	if state == cluster.WorkerDraining {
+		go DrainLocal()
+	}
+	return map[string]interface{}{"node": node, "state": state}, &utils.CodeType{}
+}
+
+// DrainLocal 将本节点的常驻任务迁移到其他节点, 节点状态不再是 draining 时停止
+// 迁移失败的任务(如暂时资源不足)按退避间隔重试, 直到本节点没有剩余任务
+func DrainLocal() {
+	if !atomic.CompareAndSwapInt32(&draining, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&draining, 0)
+
+	localNode, err := process.GetHostName()
+	if err != nil {
+		level.Error(log.Logger).Log("GetHostName Err", err.Error())
+		return
+	}
+
+	var (
+		taskDao = &dao.Task{}
+		delay   = drainRetryMin
+		moved   int
+	)
+	for {
+		n, ok := drainPass(localNode)
+		moved += n
+		if !ok {
+			level.Info(log.Logger).Log("msg", "Drain canceled", "node", localNode, "moved", moved)
+			return
+		}
+		remaining, err := taskDao.WithContext(context.Background()).GetTargetNodeTaskCount(localNode)
+		if err != nil {
+			level.Error(log.Logger).Log("GetTargetNodeTaskCount Err", err.Error())
+		} else if remaining == 0 {
+			level.Info(log.Logger).Log("msg", "Drain finished", "node", localNode, "moved", moved)
+			return
+		}
+
+		// 本轮有任务迁移成功时从最小间隔重新退避
+		if n > 0 {
+			delay = drainRetryMin
+		}
+		level.Warn(log.Logger).Log("msg", "Drain incomplete, retry later", "node", localNode, "remaining", remaining, "delay", delay)
+		time.Sleep(delay)
+		if delay *= 2; delay > drainRetryMax {
+			delay = drainRetryMax
+		}
+		if cluster.WkMg.State() != cluster.WorkerDraining {
+			level.Info(log.Logger).Log("msg", "Drain canceled", "node", localNode, "moved", moved)
+			return
+		}
+	}
+}
+
+// drainPass 迁移一遍本节点的常驻任务, 返回迁移成功的数量, 节点状态不再是 draining 时返回 false
+func drainPass(localNode string) (int, bool) {
+	var (
+		batchSize = 1000
+		taskDao   = &dao.Task{}
+		notDoOnce = int64(consts.NotDoOnce)
+		filter    = dao.TaskFilter{Node: localNode, DoOnce: &notDoOnce}
+		cursor    int64
+		moved     int
+	)
+	for {
+		list, err := taskDao.WithContext(context.Background()).List(filter, cursor, batchSize)
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "Drain list tasks err", "err", err)
+			return moved, true
+		}
+		if len(list) == 0 {
+			break
+		}
+		cursor = list[len(list)-1].ID
+
+		for i := range list {
+			if cluster.WkMg.State() != cluster.WorkerDraining {
+				return moved, false
+			}
+			if drainTask(&list[i], localNode) {
+				moved++
+			}
+		}
+		if len(list) < batchSize {
+			break
+		}
+	}
+	return moved, true
+}
+
+// drainTask 先修改归属再停止本地进程, 退出回调发现任务已迁移不会再更新记录, 最后在目标节点拉起
+func drainTask(task *entity.Task, localNode string) bool {
+	var taskDao = &dao.Task{}
+
+	targetNode, err := placeTask(task)
+	if err != nil {
+		msg := fmt.Sprintf("drain from %s: %s", localNode, err.Error())
+		level.Warn(log.Logger).Log("msg", "Drain task fail", "jobId", task.JobId, "err", msg)
+		recordEvent(task.JobId, EventDrainFailed, localNode, "", msg)
+		return false
+	}
+
+	ok, err := moveTask(task, localNode, targetNode)
+	if err != nil || !ok {
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "MoveNode Err", "jobId", task.JobId, "err", err)
+		}
+		return false
+	}
+
+	_, tracked := process.PManager.JobExist(task.JobId)
+	// 等待重启的任务也视为运行中
+	running := tracked || cancelRestart(task.JobId)
+	releaseLocal(task.JobId)
+
+	if running {
+		if err = adoptOn(targetNode, task); err != nil {
+			msg := fmt.Sprintf("drain from %s to %s: %s", localNode, targetNode, err.Error())
+			level.Error(log.Logger).Log("msg", "Drain task fail", "jobId", task.JobId, "err", msg)
+			_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusFailed, process.OutcomeLost, msg)
+			recordEvent(task.JobId, EventDrainFailed, localNode, targetNode, msg)
+			return false
+		}
+	}
+
+	level.Info(log.Logger).Log("msg", "Task drained", "jobId", task.JobId, "to", targetNode, "running", running)
+	recordEvent(task.JobId, EventDrain, localNode, targetNode, "")
+	return true
+}
+
+// releaseLocal 停止本地进程但保留任务记录
+func releaseLocal(jobId string) {
+	unwatchHealth(jobId)
+	clearRestartHistory(jobId)
+	if pid, ok := process.PManager.JobExist(jobId); ok {
+		if _, err := process.PManager.StopProc(jobId, pid, false); err != nil {
+			level.Error(log.Logger).Log("msg", "Release task err", "jobId", jobId, "pid", pid, "err", err)
+		}
+		if cluster.WkMg != nil {
+			cluster.WkMg.DecrTaskCount()
+		}
+	}
+}
+
+// ReleaseMovedTasks 停止本节点上记录已转移到其他节点或已删除的任务进程
+// 节点与 etcd 失联超过租约 TTL 后任务会被故障转移, 恢复后需要停止本地的副本, 避免同一任务运行两份
+func ReleaseMovedTasks() {
+	var taskDao = &dao.Task{}
+	hostName, err := process.GetHostName()
+	if err != nil {
+		level.Error(log.Logger).Log("GetHostName Err", err.Error())
+		return
+	}
+	for _, jobId := range process.PManager.JobIds() {
+		pid, ok := process.PManager.JobExist(jobId)
+		if !ok {
+			continue
+		}
+		// 刚启动的进程可能还没有写入 task 记录
+		if started := process.PManager.StartTime(pid); started > 0 && time.Since(time.UnixMilli(started)) < releaseGrace {
+			continue
+		}
+		task, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "GetByJobId Err", "jobId", jobId, "err", err)
+			continue
+		}
+		if task.ID > 0 && task.Node == hostName {
+			continue
+		}
+		level.Warn(log.Logger).Log("msg", "Release task owned by other node", "jobId", jobId, "pid", pid, "owner", task.Node)
+		releaseLocal(jobId)
+	}
+}
+
+// DrainStatus 节点状态及剩余任务, remaining 为 0 时迁移完成
+func DrainStatus(node string) (interface{}, *utils.CodeType) {
+	if cluster.WkMg == nil {
+		return nil, utils.NotClusterMode
+	}
+	state := "offline"
+	if worker, ok := cluster.WkMg.View().Get(node); ok {
+		state = worker.Status
+	}
+
+	var (
+		taskDao   = &dao.Task{}
+		notDoOnce = int64(consts.NotDoOnce)
+	)
+	remaining, err := taskDao.WithContext(context.Background()).GetTargetNodeTaskCount(node)
+	if err != nil {
+		level.Error(log.Logger).Log("GetTargetNodeTaskCount Err", err.Error())
+		return nil, utils.DBErr
+	}
+	list, err := taskDao.WithContext(context.Background()).List(dao.TaskFilter{Node: node, DoOnce: &notDoOnce}, 0, drainStatusJobLimit)
+	if err != nil {
+		level.Error(log.Logger).Log("List Err", err.Error())
+		return nil, utils.DBErr
+	}
+	jobs := make([]map[string]interface{}, 0, len(list))
+	for _, task := range list {
+		jobs = append(jobs, map[string]interface{}{
+			"jobId":     task.JobId,
+			"status":    task.Status,
+			"lastError": task.LastError,
+		})
+	}
+
+	return map[string]interface{}{
+		"node":      node,
+		"state":     state,
+		"remaining": remaining,
+		"jobs":      jobs,
+		"done":      state == cluster.WorkerDraining && remaining == 0,
+	}, &utils.CodeType{}
+}
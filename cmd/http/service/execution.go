@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	defaultExecWorkers     = 4
+	defaultExecQueueSize   = 1000
+	defaultExecOutputLimit = 64 * 1024
+	defaultExecTimeout     = 300
+
+	// 等待其他节点上的执行结束时轮询 DB 的间隔
+	execPollInterval = 500 * time.Millisecond
+)
+
+// ExecutionConfig doOnce 任务的执行配置, outputLimit 单位字节
+type ExecutionConfig struct {
+	Workers     int `mapstructure:"workers"`
+	QueueSize   int `mapstructure:"queuesize"`
+	OutputLimit int `mapstructure:"outputlimit"`
+	// 任务未设置 timeout 时的执行超时, 单位秒
+	Timeout int `mapstructure:"timeout"`
+}
+
+var (
+	execConfig     *ExecutionConfig
+	execConfigOnce sync.Once
+	execQueue      chan *entity.JobExecution
+	execPoolOnce   sync.Once
+	// 本节点排队或执行中的 execId, 执行结束时关闭, 用于等待结果
+	execDone sync.Map
+)
+
+func GetExecutionConfig() *ExecutionConfig {
+	execConfigOnce.Do(func() {
+		execConfig = &ExecutionConfig{}
+		if conf, err := core.GetSingleConfig(core.CoreConfig, "execution", ExecutionConfig{}); err == nil {
+			execConfig = conf.(*ExecutionConfig)
+		}
+		if execConfig.Workers <= 0 {
+			execConfig.Workers = defaultExecWorkers
+		}
+		if execConfig.QueueSize <= 0 {
+			execConfig.QueueSize = defaultExecQueueSize
+		}
+		if execConfig.OutputLimit <= 0 {
+			execConfig.OutputLimit = defaultExecOutputLimit
+		}
+		if execConfig.Timeout <= 0 {
+			execConfig.Timeout = defaultExecTimeout
+		}
+	})
+	return execConfig
+}
+
+func startExecWorkers() {
+	execPoolOnce.Do(func() {
+		conf := GetExecutionConfig()
+		execQueue = make(chan *entity.JobExecution, conf.QueueSize)
+		for i := 0; i < conf.Workers; i++ {
+			go func() {
+				for execution := range execQueue {
+					runExecution(execution)
+				}
+			}()
+		}
+	})
+}
+
+// enqueueExecution 队列已满时返回 false
+func enqueueExecution(execution *entity.JobExecution) bool {
+	startExecWorkers()
+	done := make(chan struct{})
+	execDone.Store(execution.ExecId, done)
+	select {
+	case execQueue <- execution:
+		return true
+	default:
+		execDone.Delete(execution.ExecId)
+		return false
+	}
+}
+
+// submitExecution 记录执行并放入本节点的执行队列, 立即返回
+func submitExecution(req params.JobCfg) (*entity.JobExecution, *utils.CodeType) {
+	var (
+		execDao = &dao.JobExecution{}
+		now     = time.Now()
+	)
+	node, err := process.GetHostName()
+	if err != nil {
+		level.Error(log.Logger).Log("GetHostName Err", err.Error())
+		return nil, utils.ServerErr
+	}
+	execution := &entity.JobExecution{
+		ExecId:     utils.GetID(32),
+		Node:       node,
+		Cmd:        req.Run.Cmd,
+		Args:       strings.Join(req.Run.Args, SplitTag),
+		Status:     consts.ExecStatusQueued,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if spec, err := json.Marshal(req); err == nil {
+		execution.Spec = string(spec)
+	}
+	if err = execDao.WithContext(context.Background()).Create(execution); err != nil {
+		level.Error(log.Logger).Log("Create execution Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	if !enqueueExecution(execution) {
+		level.Warn(log.Logger).Log("msg", "Execution queue is full", "execId", execution.ExecId)
+		finishExecution(execution, consts.ExecStatusFailed, "", "execution queue is full")
+		return nil, utils.ExecQueueFull
+	}
+	return execution, &utils.CodeType{}
+}
+
+func runExecution(execution *entity.JobExecution) {
+	var (
+		execDao = &dao.JobExecution{}
+		conf    = GetExecutionConfig()
+		spec    = execSpec(execution)
+		start   = time.Now()
+		timeout = time.Duration(conf.Timeout) * time.Second
+	)
+	if spec.Timeout > 0 {
+		timeout = time.Duration(spec.Timeout) * time.Second
+	}
+	defer func() {
+		if done, ok := execDone.LoadAndDelete(execution.ExecId); ok {
+			close(done.(chan struct{}))
+		}
+	}()
+
+	if err := execDao.WithContext(context.Background()).UpdateRunning(execution.ID, start); err != nil {
+		level.Error(log.Logger).Log("msg", "Update execution running err", "execId", execution.ExecId, "err", err)
+	}
+	result, err := process.RunOnce(context.Background(), process.ExecSpec{
+		Cmd:         spec.Run.Cmd,
+		Args:        spec.Run.Args,
+		Outfile:     spec.Run.Outfile,
+		Errfile:     spec.Run.Errfile,
+		Timeout:     timeout,
+		Stop:        stopOptions(spec),
+		OutputLimit: conf.OutputLimit,
+	})
+	execution.DurationMs = result.Duration.Milliseconds()
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Run execution err", "execId", execution.ExecId, "arg", spec.Run, "err", err)
+		finishExecution(execution, consts.ExecStatusFailed, process.OutcomeStartFailed, err.Error())
+		return
+	}
+
+	execution.ExitCode = result.ExitCode
+	execution.Stdout, execution.Stderr = result.Stdout, result.Stderr
+	execution.Truncated = result.Truncated
+	ev := process.ExitEvent{ExitCode: result.ExitCode, Signal: result.Signal}
+	if result.TimedOut {
+		ev.Reason = process.OutcomeTimeout
+	}
+	outcome := restartPolicy(spec).Outcome(ev)
+	status, lastError := int64(consts.ExecStatusSucceeded), ""
+	if outcome != process.OutcomeSuccess {
+		status = consts.ExecStatusFailed
+		lastError = exitDesc(ev)
+	}
+	if result.TimedOut {
+		lastError += "; timed out after " + timeout.String()
+	}
+	finishExecution(execution, status, outcome, lastError)
+}
+
+func finishExecution(execution *entity.JobExecution, status int64, outcome, lastError string) {
+	var (
+		execDao = &dao.JobExecution{}
+		now     = time.Now()
+	)
+	execution.Status = status
+	execution.Outcome = outcome
+	execution.LastError = lastError
+	execution.EndTime = &now
+	if err := execDao.WithContext(context.Background()).UpdateResult(execution); err != nil {
+		level.Error(log.Logger).Log("msg", "Update execution result err", "execId", execution.ExecId, "err", err)
+	}
+}
+
+func execSpec(execution *entity.JobExecution) params.JobCfg {
+	var spec params.JobCfg
+	if err := json.Unmarshal([]byte(execution.Spec), &spec); err != nil {
+		level.Warn(log.Logger).Log("msg", "Invalid execution spec", "execId", execution.ExecId, "err", err)
+	}
+	if spec.Run.Cmd == "" {
+		spec.Run.Cmd = execution.Cmd
+		if execution.Args != "" {
+			spec.Run.Args = strings.Split(execution.Args, SplitTag)
+		}
+	}
+	return spec
+}
+
+// RecoverExecutions 守护进程重启后, 重新排队本节点未开始的执行, 执行中的记录为 lost
+func RecoverExecutions() error {
+	var (
+		batchSize = 1000
+		execDao   = &dao.JobExecution{}
+		cursor    int64
+	)
+	node, err := process.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	for _, status := range []int64{consts.ExecStatusRunning, consts.ExecStatusQueued} {
+		filter := dao.ExecutionFilter{Node: node, Status: &status}
+		cursor = 0
+		for {
+			list, err := execDao.WithContext(context.Background()).List(filter, cursor, batchSize)
+			if err != nil {
+				return err
+			}
+			for i := range list {
+				execution := &list[i]
+				if status == consts.ExecStatusRunning {
+					finishExecution(execution, consts.ExecStatusFailed, process.OutcomeLost, "wsystemd restarted during execution")
+					continue
+				}
+				if !enqueueExecution(execution) {
+					finishExecution(execution, consts.ExecStatusFailed, "", "execution queue is full")
+				}
+			}
+			if len(list) < batchSize {
+				break
+			}
+			cursor = list[len(list)-1].ID
+		}
+	}
+	return nil
+}
+
+// ExecutionInfo 执行详情, wait 大于 0 时等待执行结束后返回, 超时返回当前状态
+func ExecutionInfo(req params.ExecutionInfo) (interface{}, *utils.CodeType) {
+	deadline := time.Now().Add(time.Duration(req.Wait) * time.Second)
+	for {
+		execution, code := findExecution(req.ExecId)
+		if code.Code != 0 {
+			return nil, code
+		}
+		remaining := time.Until(deadline)
+		if execution.Status >= consts.ExecStatusSucceeded || remaining <= 0 {
+			return execution, &utils.CodeType{}
+		}
+
+		// 本节点的执行等待结束通知, 其他节点的执行轮询 DB
+		wait := execPollInterval
+		if remaining < wait {
+			wait = remaining
+		}
+		if done, ok := execDone.Load(req.ExecId); ok {
+			wait = remaining
+			select {
+			case <-done.(chan struct{}):
+			case <-time.After(wait):
+			}
+			continue
+		}
+		time.Sleep(wait)
+	}
+}
+
+// ExecutionList 执行列表, 不返回输出内容
+func ExecutionList(req params.ExecutionList) (interface{}, *utils.CodeType) {
+	var (
+		execDao = &dao.JobExecution{}
+		filter  = dao.ExecutionFilter{Node: req.Node, Status: req.Status}
+		limit   = req.Limit
+	)
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	list, err := execDao.WithContext(context.Background()).List(filter, req.Cursor, limit+1)
+	if err != nil {
+		level.Error(log.Logger).Log("ExecutionList Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	hasMore := len(list) > limit
+	if hasMore {
+		list = list[:limit]
+	}
+	nextCursor := req.Cursor
+	if len(list) > 0 {
+		nextCursor = list[len(list)-1].ID
+	}
+	return map[string]interface{}{
+		"list":       list,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
+	}, &utils.CodeType{}
+}
+
+func findExecution(execId string) (*entity.JobExecution, *utils.CodeType) {
+	var execDao = &dao.JobExecution{}
+	execution, err := execDao.WithContext(context.Background()).FindByExecId(execId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByExecId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if execution.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+	return execution, &utils.CodeType{}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// EventTimeout 超过 maxRuntime 被终止
+const EventTimeout = "timeout"
+
+var (
+	pendingLock     sync.Mutex
+	pendingRestarts = make(map[string]*time.Timer)
+	// 窗口内的重启时间, 用于计算退避和启动频率限制
+	restartHistory = make(map[string][]time.Time)
+)
+
+// HandleJobExit 进程退出回调, 记录退出信息并按重启策略决定是否重启
+func HandleJobExit(ev process.ExitEvent) {
+	var taskDao = &dao.Task{}
+	task, err := taskDao.WithContext(context.Background()).GetByJobId(ev.JobId)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "HandleJobExit GetByJobId Err", "jobId", ev.JobId, "err", err)
+		return
+	}
+	if task.ID <= 0 {
+		unwatchHealth(ev.JobId)
+		return
+	}
+	// 任务已被重新拉起, 或已迁移到其他节点
+	if task.Pid != ev.Pid {
+		return
+	}
+	if localNode, _ := process.GetHostName(); task.Node != localNode {
+		return
+	}
+	unwatchHealth(ev.JobId)
+
+	var (
+		lastError = exitDesc(ev)
+		status    = int64(consts.TaskStatusStopped)
+		spec      = taskSpec(task)
+		policy    = restartPolicy(spec)
+		outcome   = policy.Outcome(ev)
+	)
+	if outcome == process.OutcomeTimeout {
+		lastError = fmt.Sprintf("%s; max runtime %ds exceeded", lastError, runtimeLimit(spec))
+		recordEvent(task.JobId, EventTimeout, task.Node, "", lastError)
+	}
+	switch {
+	case ev.Stopped:
+		clearRestartHistory(task.JobId)
+	case task.DoOnce == consts.NotDoOnce && policy.ShouldRestart(ev):
+		if delay, ok := nextRestart(task.JobId, policy); ok {
+			status = consts.TaskStatusRunning
+			scheduleRestart(task.JobId, delay)
+		} else {
+			// 窗口内重启次数耗尽, 不再重启
+			status = consts.TaskStatusFailed
+			lastError = fmt.Sprintf("%s; start limit hit: %d restarts in %s",
+				lastError, policy.StartLimitBurst, policy.StartLimitInterval)
+			clearRestartHistory(task.JobId)
+			level.Error(log.Logger).Log("msg", "Task start limit hit", "jobId", task.JobId)
+		}
+	case outcome != process.OutcomeSuccess:
+		status = consts.TaskStatusFailed
+	}
+
+	if err = taskDao.WithContext(context.Background()).UpdateExit(task.ID, status, outcome, lastError); err != nil {
+		level.Error(log.Logger).Log("msg", "UpdateExit Err", "jobId", ev.JobId, "err", err)
+	}
+}
+
+func exitDesc(ev process.ExitEvent) string {
+	signal := "none"
+	if ev.Signal != 0 {
+		signal = ev.Signal.String()
+	}
+	return fmt.Sprintf("pid=%d exit_code=%d signal=%s end_time=%s",
+		ev.Pid, ev.ExitCode, signal, ev.EndTime.Format(timeLayout))
+}
+
+// scheduleRestart 延迟重启, 期间任务被停止时可通过 cancelRestart 取消
+func scheduleRestart(jobId string, delay time.Duration) {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	if _, ok := pendingRestarts[jobId]; ok {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		pendingLock.Lock()
+		// 触发时已被 cancelRestart 取消
+		if pendingRestarts[jobId] != timer {
+			pendingLock.Unlock()
+			return
+		}
+		delete(pendingRestarts, jobId)
+		pendingLock.Unlock()
+
+		var taskDao = &dao.Task{}
+		task, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
+		if err != nil || task.ID <= 0 || task.Status != consts.TaskStatusRunning {
+			return
+		}
+		if _, exist := process.PManager.JobExist(jobId); exist {
+			return
+		}
+
+		level.Info(log.Logger).Log("msg", "Restarting exited task", "jobId", jobId)
+		if err = restartTask(task); err != nil {
+			_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusFailed, process.OutcomeStartFailed, err.Error())
+			return
+		}
+		if err = taskDao.WithContext(context.Background()).IncrRetryCount(task.ID); err != nil {
+			level.Error(log.Logger).Log("msg", "IncrRetryCount Err", "jobId", jobId, "err", err)
+		}
+	})
+	pendingRestarts[jobId] = timer
+}
+
+func cancelRestart(jobId string) bool {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	timer, ok := pendingRestarts[jobId]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(pendingRestarts, jobId)
+	return true
+}
+
+func restartPending(jobId string) bool {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	_, ok := pendingRestarts[jobId]
+	return ok
+}
+
+func nextRestart(jobId string, policy process.RestartPolicy) (time.Duration, bool) {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	delay, history, ok := policy.Next(restartHistory[jobId], time.Now())
+	restartHistory[jobId] = history
+	return delay, ok
+}
+
+func clearRestartHistory(jobId string) {
+	pendingLock.Lock()
+	delete(restartHistory, jobId)
+	pendingLock.Unlock()
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// 任务事件类型
+const (
+	EventFailover       = "failover"
+	EventFailoverFailed = "failover-failed"
+	EventDrain          = "drain"
+	EventDrainFailed    = "drain-failed"
+)
+
+// FailoverLoop leader 任务, 先转移已下线节点上遗留的任务, 再监听节点下线
+// leader 切换期间下线的节点由新 leader 启动时的检查兜底
+func FailoverLoop(ctx context.Context) {
+	var taskDao = &dao.Task{}
+	nodeStats, err := taskDao.WithContext(ctx).GetNodeTaskCount()
+	if err != nil {
+		level.Error(log.Logger).Log("GetNodeTaskCount Err", err.Error())
+	}
+	for node := range nodeStats {
+		alive, err := cluster.WkMg.IsAlive(node)
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "Check worker alive err", "node", node, "err", err)
+			continue
+		}
+		if !alive {
+			level.Warn(log.Logger).Log("msg", "Found tasks on offline worker", "node", node)
+			go FailoverWorker(ctx, cluster.Worker{Hostname: node})
+		}
+	}
+
+	cluster.WkMg.WatchWorkers(ctx, FailoverWorker)
+}
+
+// FailoverWorker 节点下线回调, 将其常驻任务转移到存活节点
+// 通过集群锁及 MoveNode 保证 leader 切换时每个任务也只转移一次, ctx 取消(失去 leadership)时放弃
+func FailoverWorker(ctx context.Context, worker cluster.Worker) {
+	timer := time.NewTimer(cluster.FailoverDelay())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	err := cluster.WkMg.Lock(ctx, "failover/"+worker.Hostname, func() error {
+		alive, err := cluster.WkMg.IsAlive(worker.Hostname)
+		if err != nil {
+			return err
+		}
+		if alive {
+			level.Info(log.Logger).Log("msg", "Worker back online, skip failover", "node", worker.Hostname)
+			return nil
+		}
+		return failoverTasks(ctx, worker.Hostname)
+	})
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Failover worker fail", "node", worker.Hostname, "err", err)
+	}
+}
+
+func failoverTasks(ctx context.Context, deadNode string) error {
+	var (
+		batchSize = 1000
+		taskDao   = &dao.Task{}
+		running   = int64(consts.TaskStatusRunning)
+		notDoOnce = int64(consts.NotDoOnce)
+		filter    = dao.TaskFilter{Node: deadNode, Status: &running, DoOnce: &notDoOnce}
+		cursor    int64
+		moved     int
+	)
+	for {
+		list, err := taskDao.WithContext(ctx).List(filter, cursor, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			break
+		}
+		cursor = list[len(list)-1].ID
+
+		for i := range list {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if failoverTask(&list[i], deadNode) {
+				moved++
+			}
+		}
+		if len(list) < batchSize {
+			break
+		}
+	}
+	level.Info(log.Logger).Log("msg", "Failover finished", "node", deadNode, "moved", moved)
+	return nil
+}
+
+// failoverTask 重新调度并在目标节点拉起任务, 约束无法满足时标记为失败
+func failoverTask(task *entity.Task, fromNode string) bool {
+	var taskDao = &dao.Task{}
+
+	targetNode, err := placeTask(task)
+	if err != nil {
+		msg := fmt.Sprintf("failover from %s: %s", fromNode, err.Error())
+		level.Warn(log.Logger).Log("msg", "Failover task fail", "jobId", task.JobId, "err", msg)
+		_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusFailed, process.OutcomeLost, msg)
+		recordEvent(task.JobId, EventFailoverFailed, fromNode, "", msg)
+		return false
+	}
+
+	ok, err := moveTask(task, fromNode, targetNode)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "MoveNode Err", "jobId", task.JobId, "err", err)
+		return false
+	}
+	if !ok {
+		// 已被其他节点转移或被删除
+		return false
+	}
+
+	if err = adoptOn(targetNode, task); err != nil {
+		msg := fmt.Sprintf("failover from %s to %s: %s", fromNode, targetNode, err.Error())
+		level.Error(log.Logger).Log("msg", "Failover task fail", "jobId", task.JobId, "err", msg)
+		_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusFailed, process.OutcomeLost, msg)
+		recordEvent(task.JobId, EventFailoverFailed, fromNode, targetNode, msg)
+		return false
+	}
+
+	level.Info(log.Logger).Log("msg", "Task failed over", "jobId", task.JobId, "from", fromNode, "to", targetNode)
+	recordEvent(task.JobId, EventFailover, fromNode, targetNode, "")
+	return true
+}
+
+// placeTask 按任务提交时的配置重新调度
+func placeTask(task *entity.Task) (string, error) {
+	spec := taskSpec(task)
+	if spec.Run.Cmd == "" {
+		// 旧数据没有 spec, 按 task 记录调度
+		spec.Run = params.JobRun{Cmd: task.Cmd, Args: strings.Split(task.Args, SplitTag)}
+		spec.LoadMethod = task.LoadMethod
+	}
+
+	targetNode, err := cluster.GetWorkNode(scheduleRequest(spec))
+	if err == nil && targetNode == "" {
+		err = cluster.ErrNoAvailableWorker
+	}
+	return targetNode, err
+}
+
+// moveTask 修改任务归属, dc/ip 取目标节点注册的信息, 指定了 ip 约束的任务保留约束中的 ip
+func moveTask(task *entity.Task, fromNode, toNode string) (bool, error) {
+	var taskDao = &dao.Task{}
+	dc, ip := task.Dc, task.Ip
+	if worker, err := cluster.GetWorkerInfo(toNode); err == nil {
+		dc, ip = worker.Dc, worker.IP
+		if spec := taskSpec(task); spec.Ip != "" {
+			ip = spec.Ip
+		}
+	}
+	return taskDao.WithContext(context.Background()).MoveNode(task.ID, fromNode, toNode, dc, ip)
+}
+
+func adoptOn(targetNode string, task *entity.Task) error {
+	localNode, err := process.GetHostName()
+	if err != nil {
+		return err
+	}
+	if targetNode == localNode {
+		return adoptLocal(task)
+	}
+	client, err := cluster.ClientFor(targetNode)
+	if err != nil {
+		return err
+	}
+	return client.Adopt(context.Background(), task.JobId)
+}
+
+// AdoptJob 在本节点拉起已分配到本节点的任务记录, 用于故障转移
+func AdoptJob(jobId string) (interface{}, *utils.CodeType) {
+	var taskDao = &dao.Task{}
+	task, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
+	if err != nil {
+		level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if task.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+
+	localNode, err := process.GetHostName()
+	if err != nil {
+		level.Error(log.Logger).Log("GetHostName Err", err.Error())
+		return nil, utils.ServerErr
+	}
+	if task.Node != localNode {
+		return nil, utils.ReqParamErr
+	}
+
+	if pid, ok := process.PManager.JobExist(jobId); ok {
+		return map[string]interface{}{"id": jobId, "pid": pid, "node": localNode}, &utils.CodeType{}
+	}
+	if err = adoptLocal(task); err != nil {
+		return nil, utils.StartJobFail
+	}
+	return map[string]interface{}{"id": jobId, "pid": task.Pid, "node": localNode}, &utils.CodeType{}
+}
+
+func adoptLocal(task *entity.Task) error {
+	if err := restartTask(task); err != nil {
+		return err
+	}
+	if cluster.WkMg != nil {
+		cluster.WkMg.IncrTaskCount()
+	}
+	return nil
+}
+
+func recordEvent(jobId, typ, fromNode, toNode, message string) {
+	var eventDao = &dao.TaskEvent{}
+	event := entity.TaskEvent{
+		JobId:      jobId,
+		Type:       typ,
+		FromNode:   fromNode,
+		ToNode:     toNode,
+		Message:    message,
+		CreateTime: time.Now(),
+	}
+	if err := eventDao.WithContext(context.Background()).Create(&event); err != nil {
+		level.Error(log.Logger).Log("msg", "Create task event Err", "jobId", jobId, "err", err)
+	}
+}
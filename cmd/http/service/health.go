@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"wsystemd/cmd/health"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// watchHealth 任务进程启动后开始健康检查
+func watchHealth(jobId string, spec params.JobCfg) {
+	if health.HEngine == nil || len(spec.Checks) == 0 {
+		return
+	}
+	health.HEngine.Register(jobId, spec.Checks)
+}
+
+func unwatchHealth(jobId string) {
+	if health.HEngine == nil {
+		return
+	}
+	health.HEngine.Unregister(jobId)
+}
+
+// HandleHealthChange 健康状态变化回调
+// 不健康时按重启策略终止进程触发重启, 策略为 no 时只标记不健康
+func HandleHealthChange(jobId, state string, r health.Result) {
+	var taskDao = &dao.Task{}
+	task, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
+	if err != nil || task.ID <= 0 {
+		return
+	}
+
+	var lastError string
+	if state == health.StateUnhealthy {
+		lastError = fmt.Sprintf("health check %s %s failed %d times: %s",
+			r.Type, r.Target, r.ConsecutiveFails, r.LastError)
+	}
+	if err = taskDao.WithContext(context.Background()).UpdateHealth(task.ID, state, lastError); err != nil {
+		level.Error(log.Logger).Log("msg", "UpdateHealth Err", "jobId", jobId, "err", err)
+	}
+	if state != health.StateUnhealthy {
+		return
+	}
+
+	level.Warn(log.Logger).Log("msg", "Task unhealthy", "jobId", jobId, "err", lastError)
+	if restartPolicy(taskSpec(task)).Policy == process.RestartNo {
+		return
+	}
+	if err = process.PManager.Kill(jobId, process.OutcomeUnhealthy); err != nil {
+		level.Error(log.Logger).Log("msg", "Kill unhealthy task Err", "jobId", jobId, "err", err)
+	}
+}
@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"strings"
 	"time"
 	"wsystemd/cmd/cluster"
@@ -25,8 +26,30 @@ var (
 )
 
 func CreateClusterModeJob(req params.JobCfg) (interface{}, *utils.CodeType) {
+	return createClusterModeJob(req, nil)
+}
+
+// createClusterModeJob placed 不为空时跳过其中的节点, 并记录本次放置的节点
+func createClusterModeJob(req params.JobCfg, placed map[string]bool) (interface{}, *utils.CodeType) {
+	if req.Num > 1 && req.ParentId == "" && !req.DoOnce {
+		return CreateService(req)
+	}
+
+	sreq := scheduleRequest(req)
+	sreq.Exclude = placed
 	if val, ok := core.CoreConfig["singlemode"]; ok && val.(bool) {
-		return createJobLocal(req)
+		if sreq.HasConstraints() {
+			local, err := cluster.LocalWorker()
+			if err != nil {
+				level.Error(log.Logger).Log("LocalWorker Err", err.Error())
+				return nil, utils.ServerErr
+			}
+			if err = cluster.MatchConstraints(sreq, &local); err != nil {
+				level.Warn(log.Logger).Log("msg", "Local node not match constraints", "err", err.Error())
+				return nil, utils.NoAvailableWorker
+			}
+		}
+		return CreateJobLocal(req)
 	}
 
 	localNode, err := process.GetHostName()
@@ -35,8 +58,21 @@ func CreateClusterModeJob(req params.JobCfg) (interface{}, *utils.CodeType) {
 		return nil, utils.ServerErr
 	}
 
-	targetNode, err := cluster.GetWorkNode()
+	targetNode, err := cluster.GetWorkNode(sreq)
+	if errors.Is(err, cluster.ErrNoCapacity) {
+		level.Warn(log.Logger).Log("msg", "No worker has capacity", "err", err.Error())
+		return nil, utils.NoCapacity
+	}
+	if errors.Is(err, cluster.ErrNoAvailableWorker) {
+		level.Warn(log.Logger).Log("msg", "No worker passed filters", "err", err.Error())
+		return nil, utils.NoAvailableWorker
+	}
 	if err != nil {
+		// dc/ip/selector 只记录在 etcd 中, 无法回退到数据库校验
+		if sreq.Dc != "" || sreq.Ip != "" || len(sreq.Selector) > 0 {
+			level.Error(log.Logger).Log("GetWorkNode Err", err.Error())
+			return nil, utils.ServerErr
+		}
 		// 如果获取失败，回退到数据库查询, 按照 task 进行调度
 		var taskDao = &dao.Task{}
 		nodeStats, err := taskDao.WithContext(context.Background()).GetNodeTaskCount()
@@ -44,42 +80,81 @@ func CreateClusterModeJob(req params.JobCfg) (interface{}, *utils.CodeType) {
 			level.Error(log.Logger).Log("GetNodeTaskCount Err", err.Error())
 			return nil, utils.DBErr
 		}
-		if len(nodeStats) != 0 {
-			minTasks := 0
-			for node, count := range nodeStats {
-				if int(count) < minTasks {
-					minTasks = int(count)
-					targetNode = node
-				}
+		minTasks := int64(-1)
+		skipped := false
+		for node, count := range nodeStats {
+			if sreq.Node != "" && node != sreq.Node {
+				continue
+			}
+			if placed[node] {
+				skipped = true
+				continue
+			}
+			if minTasks < 0 || count < minTasks {
+				minTasks = count
+				targetNode = node
 			}
 		}
+		if targetNode == "" && skipped {
+			return nil, utils.NoCapacity
+		}
+	}
+	if targetNode == "" {
+		return nil, utils.NoAvailableWorker
 	}
 
 	if targetNode == localNode {
-		return createJobLocal(req)
+		res, code := CreateJobLocal(req)
+		if code.Code == 0 && placed != nil {
+			placed[targetNode] = true
+		}
+		return res, code
 	}
 
-	worker, err := cluster.GetWorkerInfo(targetNode)
+	client, err := cluster.ClientFor(targetNode)
 	if err != nil {
 		level.Error(log.Logger).Log("GetWorkerInfo Err", err.Error())
-		return nil, utils.ServerErr
+		return nil, cluster.CodeOf(err)
 	}
 
-	response, err := cluster.ForwardToWorker(worker, "/v1/jobs/submit", req)
+	response, err := client.Submit(context.Background(), req)
 	if err != nil {
-		level.Error(log.Logger).Log("ForwardRequest Err", err.Error())
-		return nil, utils.ServerErr
+		level.Error(log.Logger).Log("msg", "Submit to worker err", "node", targetNode, "err", err)
+		return nil, cluster.CodeOf(err)
+	}
+	if placed != nil {
+		placed[targetNode] = true
 	}
 
 	return response, &utils.CodeType{}
 }
 
-func createJobLocal(req params.JobCfg) (interface{}, *utils.CodeType) {
+func scheduleRequest(req params.JobCfg) *cluster.ScheduleRequest {
+	return &cluster.ScheduleRequest{
+		LoadMethod: req.LoadMethod,
+		Key:        scheduleKey(req),
+		Node:       req.Node,
+		Dc:         req.Dc,
+		Ip:         req.Ip,
+		Selector:   req.Selector,
+	}
+}
+
+// scheduleKey hash 调度使用的 key, 多副本任务按副本区分以便分散到不同节点
+func scheduleKey(req params.JobCfg) string {
+	if req.ParentId != "" {
+		return fmt.Sprintf("%s#%d", req.ParentId, req.Replica)
+	}
+	return req.Run.Cmd + " " + strings.Join(req.Run.Args, " ")
+}
+
+func CreateJobLocal(req params.JobCfg) (interface{}, *utils.CodeType) {
 	var (
 		taskModel entity.Task
 		taskDao   = &dao.Task{}
 		res       = make(map[string]interface{})
 		pid       int
+		token     string
 		uuid      = utils.GetID(32)
 		err       error
 	)
@@ -91,18 +166,20 @@ func createJobLocal(req params.JobCfg) (interface{}, *utils.CodeType) {
 		return doOnceJob(req)
 	}
 
-	pid, err = process.PManager.StartProc(req.Run.Cmd, req.Run.Args, req.Run.Outfile, req.Run.Errfile, uuid)
+	pid, token, err = process.PManager.StartProc(req.Run.Cmd, req.Run.Args, req.Run.Outfile, req.Run.Errfile, uuid)
 	if err != nil {
 		level.Error(log.Logger).Log("CreateSingleModeJob Err", err.Error())
 		return nil, utils.StartJobFail
 	}
 
-	taskModel = buildTaskModel(req, pid, uuid)
+	applyLimits(uuid, req, time.Now())
+	taskModel = buildTaskModel(req, pid, uuid, token)
 
 	if err := taskDao.WithContext(context.Background()).Create(&taskModel); err != nil {
 		level.Error(log.Logger).Log("CreateSingleModeJob Err", err.Error())
 		return res, utils.DBErr
 	}
+	watchHealth(uuid, req)
 
 	// 更新内存中的任务计数
 	if !req.DoOnce && cluster.WkMg != nil {
@@ -117,40 +194,22 @@ func createJobLocal(req params.JobCfg) (interface{}, *utils.CodeType) {
 	return res, &utils.CodeType{}
 }
 
+// doOnceJob 放入执行队列后立即返回执行 ID, 结果通过 /v1/execution/info 查询
 func doOnceJob(req params.JobCfg) (interface{}, *utils.CodeType) {
-	res := make(map[string]interface{})
-	uuid := utils.GetID(32)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, req.Run.Cmd, req.Run.Args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Start()
-	if err != nil {
-		level.Error(log.Logger).Log("Do OnceJob Start Error", err.Error(), "arg", req.Run)
-		return nil, utils.StartJobFail
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			level.Error(log.Logger).Log("Do OnceJob Out Time", context.DeadlineExceeded, "arg", req.Run)
-			return nil, utils.JobExecOutTime
-		}
-		level.Error(log.Logger).Log("Do OnceJob Err", err.Error(), "arg", req.Run)
-		return nil, utils.StartJobFail
-	}
-
-	res["id"] = uuid
-	res["ctime"] = utils.GetCTime()
-	res["run"] = req.Run
-	return res, &utils.CodeType{}
+	execution, code := submitExecution(req)
+	if code.Code != 0 {
+		return nil, code
+	}
+	return map[string]interface{}{
+		"id":     execution.ExecId,
+		"node":   execution.Node,
+		"status": execution.Status,
+		"ctime":  utils.GetCTime(),
+		"run":    req.Run,
+	}, &utils.CodeType{}
 }
 
-func buildTaskModel(req params.JobCfg, pid int, jobId string) entity.Task {
+func buildTaskModel(req params.JobCfg, pid int, jobId, token string) entity.Task {
 	now := time.Now()
 	taskModel := entity.Task{
 		Args:          strings.Join(req.Run.Args, SplitTag),
@@ -158,8 +217,11 @@ func buildTaskModel(req params.JobCfg, pid int, jobId string) entity.Task {
 		Errfile:       req.Run.Errfile,
 		Outfile:       req.Run.Outfile,
 		Pid:           pid,
+		ProcStartTime: process.PManager.StartTime(pid),
 		JobId:         jobId,
-		Dc:            req.Dc,
+		Token:         token,
+		ParentId:      req.ParentId,
+		Replica:       req.Replica,
 		Ip:            req.Ip,
 		LoadMethod:    req.LoadMethod,
 		CreateTime:    now,
@@ -167,17 +229,28 @@ func buildTaskModel(req params.JobCfg, pid int, jobId string) entity.Task {
 		HeartBeatTime: now,
 	}
 
+	if spec, err := json.Marshal(req); err == nil {
+		taskModel.Spec = string(spec)
+	}
+
 	if req.DoOnce {
 		taskModel.DoOnce = consts.DoOnce
 	} else {
 		taskModel.DoOnce = consts.NotDoOnce
 	}
 
-	if req.Node == "" {
-		hName, _ := process.GetHostName()
-		taskModel.Node = hName
-	} else {
-		taskModel.Node = req.Node
+	taskModel.Movable = consts.Movable
+	if req.Movable != nil && !*req.Movable {
+		taskModel.Movable = consts.NotMovable
+	}
+
+	// 记录实际运行的节点, 而不是请求中的约束
+	taskModel.Node, _ = process.GetHostName()
+	if dc, ok := core.CoreConfig["dc"].(string); ok {
+		taskModel.Dc = dc
+	}
+	if taskModel.Ip == "" {
+		taskModel.Ip, _ = utils.GetLocalIP()
 	}
 
 	return taskModel
@@ -185,7 +258,7 @@ func buildTaskModel(req params.JobCfg, pid int, jobId string) entity.Task {
 
 func StopBigOne(req params.BigOne) *utils.CodeType {
 	if val, ok := core.CoreConfig["singlemode"]; ok && val.(bool) {
-		return stopBigOneLocal(req)
+		return StopBigOneLocal(req)
 	}
 
 	var taskDao = &dao.Task{}
@@ -204,24 +277,23 @@ func StopBigOne(req params.BigOne) *utils.CodeType {
 	}
 
 	if info.Node != localNode {
-		worker, err := cluster.GetWorkerInfo(info.Node)
+		client, err := cluster.ClientFor(info.Node)
 		if err != nil {
 			level.Error(log.Logger).Log("GetWorkerInfo Err", err.Error())
-			return utils.ServerErr
+			return cluster.CodeOf(err)
 		}
 
-		_, err = cluster.ForwardToWorker(worker, "/v1/jobs/stopBigOne", req)
-		if err != nil {
-			level.Error(log.Logger).Log("ForwardRequest Err", err.Error())
-			return utils.ServerErr
+		if err = client.StopBigOne(context.Background(), req); err != nil {
+			level.Error(log.Logger).Log("msg", "StopBigOne on worker err", "node", info.Node, "err", err)
+			return cluster.CodeOf(err)
 		}
 		return &utils.CodeType{}
 	}
 
-	return stopBigOneLocal(req)
+	return StopBigOneLocal(req)
 }
 
-func stopBigOneLocal(req params.BigOne) *utils.CodeType {
+func StopBigOneLocal(req params.BigOne) *utils.CodeType {
 	var taskDao = &dao.Task{}
 	info, err := taskDao.WithContext(context.Background()).FindByJobId(req.BigOneJobId)
 	if err != nil {
@@ -243,7 +315,7 @@ func stopBigOneLocal(req params.BigOne) *utils.CodeType {
 
 func SingleJobReporter(req params.JobReporter) *utils.CodeType {
 	if val, ok := core.CoreConfig["singlemode"]; ok && val.(bool) {
-		return reportJobLocal(req)
+		return ReportJobLocal(req)
 	}
 
 	segs := strings.Split(req.Token, ":")
@@ -260,24 +332,23 @@ func SingleJobReporter(req params.JobReporter) *utils.CodeType {
 	}
 
 	if nodeName != localNode {
-		worker, err := cluster.GetWorkerInfo(nodeName)
+		client, err := cluster.ClientFor(nodeName)
 		if err != nil {
 			level.Error(log.Logger).Log("GetWorkerInfo Err", err.Error())
-			return utils.ServerErr
+			return cluster.CodeOf(err)
 		}
 
-		_, err = cluster.ForwardToWorker(worker, "/v1/agent/tasks/report", req)
-		if err != nil {
-			level.Error(log.Logger).Log("ForwardRequest Err", err.Error())
-			return utils.ServerErr
+		if err = client.Report(context.Background(), req); err != nil {
+			level.Error(log.Logger).Log("msg", "Report on worker err", "node", nodeName, "err", err)
+			return cluster.CodeOf(err)
 		}
 		return &utils.CodeType{}
 	}
 
-	return reportJobLocal(req)
+	return ReportJobLocal(req)
 }
 
-func reportJobLocal(req params.JobReporter) *utils.CodeType {
+func ReportJobLocal(req params.JobReporter) *utils.CodeType {
 	segs := strings.Split(req.Token, ":")
 	if len(segs) < 2 {
 		level.Error(log.Logger).Log("Invalid task token", req.Token)
@@ -304,6 +375,11 @@ func reportJobLocal(req params.JobReporter) *utils.CodeType {
 		level.Error(log.Logger).Log("FindByNodeAndPid DBRecorderNotExist")
 		return utils.DBRecorderNotExist
 	}
+	// 只接受任务启动时生成的 TASK_TOKEN, 防止伪造其他任务的心跳
+	if tInfo.Token == "" || subtle.ConstantTimeCompare([]byte(req.Token), []byte(tInfo.Token)) != 1 {
+		level.Warn(log.Logger).Log("msg", "Task token mismatch", "node", nodeName, "pid", req.Pid)
+		return utils.Unauthorized
+	}
 
 	level.Info(log.Logger).Log("msg", "client heart beat report")
 	err = taskDao.WithContext(context.Background()).UpdateHeartBeatTime(tInfo.ID)
@@ -320,17 +396,19 @@ func bigOne(req params.JobCfg) (interface{}, *utils.CodeType) {
 		taskDao   = &dao.Task{}
 		res       = make(map[string]interface{})
 		pid       int
+		token     string
 		uuid      = utils.GetID(32)
 		err       error
 	)
 
-	pid, err = process.PManager.StartProc(req.Run.Cmd, req.Run.Args, req.Run.Outfile, req.Run.Errfile, uuid)
+	pid, token, err = process.PManager.StartProc(req.Run.Cmd, req.Run.Args, req.Run.Outfile, req.Run.Errfile, uuid)
 	if err != nil {
 		level.Error(log.Logger).Log("CreateSingleModeJob Err", err.Error())
 		return nil, utils.StartJobFail
 	}
 
-	taskModel = buildTaskModel(req, pid, uuid)
+	applyLimits(uuid, req, time.Now())
+	taskModel = buildTaskModel(req, pid, uuid, token)
 	taskModel.BigOne = "bigOne"
 
 	err = taskDao.WithContext(context.Background()).Create(&taskModel)
@@ -349,14 +427,17 @@ func bigOne(req params.JobCfg) (interface{}, *utils.CodeType) {
 
 func StopSingleModeJob(jobId string, delete bool) *utils.CodeType {
 	if val, ok := core.CoreConfig["singlemode"]; ok && val.(bool) {
-		return stopJobLocal(jobId, delete)
+		return StopJobLocal(jobId, delete)
 	}
 
 	var taskDao = &dao.Task{}
-	taskInfo, err := taskDao.WithContext(context.Background()).FindByJobId(jobId)
+	taskInfo, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
 	if err != nil {
 		return utils.DBErr
 	}
+	if taskInfo.ID <= 0 {
+		return utils.StopNotExist
+	}
 
 	localNode, err := process.GetHostName()
 	if err != nil {
@@ -365,36 +446,59 @@ func StopSingleModeJob(jobId string, delete bool) *utils.CodeType {
 	}
 
 	if taskInfo.Node != localNode {
-		worker, err := cluster.GetWorkerInfo(taskInfo.Node)
+		client, err := cluster.ClientFor(taskInfo.Node)
 		if err != nil {
 			level.Error(log.Logger).Log("GetWorkerInfo Err", err.Error())
-			return utils.ServerErr
+			return cluster.CodeOf(err)
 		}
 
-		_, err = cluster.ForwardToWorker(worker, fmt.Sprintf("/v1/jobs/%s/stop", jobId), nil)
-		if err != nil {
-			level.Error(log.Logger).Log("ForwardRequest Err", err.Error())
-			return utils.ServerErr
+		if err = client.Stop(context.Background(), jobId); err != nil {
+			level.Error(log.Logger).Log("msg", "Stop on worker err", "node", taskInfo.Node, "err", err)
+			return cluster.CodeOf(err)
 		}
 		return &utils.CodeType{}
 	}
 
-	return stopJobLocal(jobId, delete)
+	return StopJobLocal(jobId, delete)
 }
 
-func stopJobLocal(jobId string, delete bool) *utils.CodeType {
-	var taskDao = &dao.Task{}
+func StopJobLocal(jobId string, delete bool) *utils.CodeType {
+	var (
+		taskDao = &dao.Task{}
+		err     error
+	)
+	unwatchHealth(jobId)
 	pid, exist := process.PManager.JobExist(jobId)
 	if !exist {
-		return utils.StopNotExist
-	}
-
-	status, err := process.PManager.StopProc(jobId, pid, delete)
-	if err != nil || status != 0 {
+		// 正在等待重启的任务, 记录已在退出时改回运行中, 取消重启后需标记为已停止, 否则巡检时会被重新拉起
+		if !cancelRestart(jobId) {
+			return utils.StopNotExist
+		}
+		clearRestartHistory(jobId)
+		task, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
 		if err != nil {
-			level.Error(log.Logger).Log("StopSingleModeJob Err", err.Error(), "pid", pid)
+			level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+			return utils.DBErr
+		}
+		if task.ID > 0 {
+			lastError := "stopped during restart backoff"
+			if task.LastError != "" {
+				lastError = task.LastError + "; " + lastError
+			}
+			if err = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusStopped,
+				process.OutcomeStopped, lastError); err != nil {
+				level.Error(log.Logger).Log("UpdateExit Err", err.Error())
+				return utils.DBErr
+			}
+		}
+	} else {
+		status, err := process.PManager.StopProc(jobId, pid, delete)
+		if err != nil || status != 0 {
+			if err != nil {
+				level.Error(log.Logger).Log("StopSingleModeJob Err", err.Error(), "pid", pid)
+			}
+			return utils.StopJobFail
 		}
-		return utils.StopJobFail
 	}
 
 	if delete {
@@ -405,6 +509,10 @@ func stopJobLocal(jobId string, delete bool) *utils.CodeType {
 		}
 	}
 
+	if delete {
+		clearRestartHistory(jobId)
+	}
+
 	if delete && cluster.WkMg != nil {
 		cluster.WkMg.DecrTaskCount()
 	}
@@ -425,9 +533,10 @@ func CheckClientAlive() error {
 		return err
 	}
 
-	// 如果是集群模式，只处理本节点的任务
+	// 如果是集群模式，只处理本节点的任务, 并停止已被转移到其他节点的任务
 	if val, ok := core.CoreConfig["singlemode"]; ok && !val.(bool) {
 		level.Info(log.Logger).Log("msg", "Running in cluster mode, checking local tasks only", "node", hostName)
+		ReleaseMovedTasks()
 	}
 
 	maxId, _ := taskDao.WithContext(context.Background()).GetMaxCount(hostName)
@@ -451,38 +560,20 @@ func CheckClientAlive() error {
 			"minId", minId, "maxId", maxId, "node", hostName)
 
 		for _, task := range list {
-			if now.Sub(task.HeartBeatTime).Minutes() > 2 {
-				if proc.IsAlive(task.Pid) {
-					// 任务存在，更新心跳时间
+			// 进程退出由 supervisor 负责记录和重启, 这里只刷新心跳
+			if _, tracked := proc.JobExist(task.JobId); tracked || restartPending(task.JobId) {
+				if now.Sub(task.HeartBeatTime).Minutes() > 2 {
 					if err = taskDao.WithContext(context.Background()).UpdateHeartBeatTime(task.ID); err != nil {
 						level.Error(log.Logger).Log("msg", "Failed to update heartbeat time",
 							"id", task.ID, "pid", task.Pid, "error", err)
-						continue
-					}
-				} else {
-					level.Info(log.Logger).Log("msg", "Restarting dead task",
-						"jobId", task.JobId, "node", hostName)
-
-					// 停止旧任务
-					StopSingleModeJob(task.JobId, false)
-
-					// 重启任务
-					procPid, err := proc.StartProc(task.Cmd,
-						strings.Split(task.Args, SplitTag),
-						task.Outfile, task.Errfile, task.JobId)
-					if err != nil {
-						level.Error(log.Logger).Log("msg", "Failed to restart task",
-							"cmd", task.Cmd, "args", task.Args, "error", err)
-						continue
-					}
-
-					// 更新PID
-					if err = taskDao.WithContext(context.Background()).UpdatePid(task.ID, procPid); err != nil {
-						level.Error(log.Logger).Log("msg", "Failed to update PID",
-							"id", task.ID, "pid", procPid, "error", err)
-						continue
 					}
 				}
+				continue
+			}
+
+			// 不在监控中的运行任务(如重启时接管失败), 兜底接管或拉起
+			if task.Status == consts.TaskStatusRunning {
+				recoverTask(&task)
 			}
 		}
 
@@ -491,3 +582,69 @@ func CheckClientAlive() error {
 		}
 	}
 }
+
+// restartTask 按 task 记录重新拉起进程并更新 pid
+func restartTask(task *entity.Task) error {
+	var taskDao = &dao.Task{}
+	procPid, token, err := process.PManager.StartProc(task.Cmd,
+		strings.Split(task.Args, SplitTag),
+		task.Outfile, task.Errfile, task.JobId)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Failed to restart task",
+			"cmd", task.Cmd, "args", task.Args, "error", err)
+		return err
+	}
+
+	if err = taskDao.WithContext(context.Background()).UpdatePid(task.ID, procPid, process.PManager.StartTime(procPid), token); err != nil {
+		level.Error(log.Logger).Log("msg", "Failed to update PID",
+			"id", task.ID, "pid", procPid, "error", err)
+		return err
+	}
+	task.Pid, task.Token = procPid, token
+	spec := taskSpec(task)
+	applyLimits(task.JobId, spec, time.Now())
+	watchHealth(task.JobId, spec)
+	return nil
+}
+
+// taskSpec 解析任务提交时的配置, 旧数据没有 spec 时返回零值
+func taskSpec(task *entity.Task) params.JobCfg {
+	var spec params.JobCfg
+	if task.Spec == "" {
+		return spec
+	}
+	if err := json.Unmarshal([]byte(task.Spec), &spec); err != nil {
+		level.Warn(log.Logger).Log("msg", "Invalid task spec", "jobId", task.JobId, "err", err)
+	}
+	return spec
+}
+
+func stopOptions(spec params.JobCfg) process.StopOptions {
+	return process.NewStopOptions(spec.StopSignal, spec.StopGrace)
+}
+
+// applyLimits 设置进程的停止信号及最长运行时间, start 为进程启动时间
+func applyLimits(jobId string, spec params.JobCfg, start time.Time) {
+	var deadline time.Time
+	if limit := runtimeLimit(spec); limit > 0 {
+		deadline = start.Add(time.Duration(limit) * time.Second)
+	}
+	process.PManager.SetLimits(jobId, stopOptions(spec), deadline)
+}
+
+// runtimeLimit 进程的最长运行时间, 单位秒; bigOne 的 doOnce 任务以常驻进程运行, timeout 同样生效
+func runtimeLimit(spec params.JobCfg) int {
+	if spec.DoOnce && spec.Timeout > 0 {
+		return spec.Timeout
+	}
+	return spec.MaxRuntime
+}
+
+func restartPolicy(spec params.JobCfg) process.RestartPolicy {
+	policy := process.NewRestartPolicy(spec.Restart, spec.RestartSec, spec.RestartMaxSec,
+		spec.StartLimitBurst, spec.StartLimitInterval)
+	policy.FailCodes = spec.FailCodes
+	policy.SuccessCodes = spec.SuccessCodes
+	policy.PreventRestartCodes = spec.PreventRestartCodes
+	return policy
+}
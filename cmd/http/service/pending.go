@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	defaultPendingInterval = 5
+	pendingBatchSize       = 100
+	// 提交中超过该时间没有结果(如提交时 leader 退出)视为失败, 不再重复提交以免创建两次
+	pendingSubmitTimeout = 5 * time.Minute
+
+	PendingReasonDelayed  = "delayed"
+	PendingReasonCapacity = "capacity"
+)
+
+// PendingConfig 待提交队列的检查间隔, 单位秒
+type PendingConfig struct {
+	Interval int `mapstructure:"interval"`
+}
+
+var (
+	pendingConfig     *PendingConfig
+	pendingConfigOnce sync.Once
+)
+
+func GetPendingConfig() *PendingConfig {
+	pendingConfigOnce.Do(func() {
+		pendingConfig = &PendingConfig{}
+		if conf, err := core.GetSingleConfig(core.CoreConfig, "pending", PendingConfig{}); err == nil {
+			pendingConfig = conf.(*PendingConfig)
+		}
+		if pendingConfig.Interval <= 0 {
+			pendingConfig.Interval = defaultPendingInterval
+		}
+	})
+	return pendingConfig
+}
+
+// SubmitJob 提交任务, 未到 submitAt/delay 或所有满足约束的节点资源不足时放入待提交队列
+func SubmitJob(req params.JobCfg) (interface{}, *utils.CodeType) {
+	now := time.Now()
+	submitAt := now
+	if req.SubmitAt != "" {
+		t, err := time.ParseInLocation(timeLayout, req.SubmitAt, time.Local)
+		if err != nil {
+			return nil, utils.ReqParamErr
+		}
+		submitAt = t
+	} else if req.Delay > 0 {
+		submitAt = now.Add(time.Duration(req.Delay) * time.Second)
+	}
+	if submitAt.After(now) {
+		return enqueuePending(req, submitAt, PendingReasonDelayed, "")
+	}
+
+	res, code := CreateClusterModeJob(req)
+	if code.Code == utils.NoCapacity.Code {
+		return enqueuePending(req, now, PendingReasonCapacity, code.Msg)
+	}
+	return res, code
+}
+
+func enqueuePending(req params.JobCfg, submitAt time.Time, reason, lastError string) (interface{}, *utils.CodeType) {
+	var (
+		pendingDao = &dao.PendingJob{}
+		now        = time.Now()
+	)
+	spec, err := json.Marshal(req)
+	if err != nil {
+		return nil, utils.ReqParamErr
+	}
+	model := entity.PendingJob{
+		PendingId:  utils.GetID(32),
+		Spec:       string(spec),
+		Priority:   priorityOf(req.Priority),
+		Reason:     reason,
+		Status:     consts.PendingWaiting,
+		SubmitAt:   submitAt,
+		LastError:  lastError,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err = pendingDao.WithContext(context.Background()).Create(&model); err != nil {
+		level.Error(log.Logger).Log("Create pending job Err", err.Error())
+		return nil, utils.DBErr
+	}
+	level.Info(log.Logger).Log("msg", "Job queued", "pendingId", model.PendingId, "reason", reason, "submitAt", submitAt.Format(timeLayout))
+	return map[string]interface{}{
+		"id":       model.PendingId,
+		"status":   model.Status,
+		"reason":   reason,
+		"submitAt": submitAt.Format(timeLayout),
+		"ctime":    utils.GetCTime(),
+	}, &utils.CodeType{}
+}
+
+func priorityOf(class string) int64 {
+	switch class {
+	case "high":
+		return consts.PriorityHigh
+	case "low":
+		return consts.PriorityLow
+	}
+	return consts.PriorityNormal
+}
+
+// PendingLoop 定期提交到期的待提交任务, 节点资源仍不足的任务继续等待, 集群模式下作为 leader 任务运行
+func PendingLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(GetPendingConfig().Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		failStalePending()
+		var pendingDao = &dao.PendingJob{}
+		list, err := pendingDao.WithContext(context.Background()).ListDue(time.Now(), pendingBatchSize)
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "List due pending jobs err", "err", err)
+			continue
+		}
+		// 节点的资源信息在两次上报之间不变, 每个节点每轮只放置一个任务, 避免同一轮全部调度到同一节点
+		placed := make(map[string]bool)
+		for i := range list {
+			if ctx.Err() != nil {
+				return
+			}
+			submitPending(&list[i], placed)
+		}
+	}
+}
+
+// submitPending 抢占后提交, 按优先级顺序处理, 资源不足的任务不阻塞后面约束不同的任务
+func submitPending(job *entity.PendingJob, placed map[string]bool) {
+	var pendingDao = &dao.PendingJob{}
+	claimed, err := pendingDao.WithContext(context.Background()).UpdateStatus(job.ID, consts.PendingWaiting, consts.PendingSubmitting,
+		map[string]interface{}{"attempts": job.Attempts + 1})
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Claim pending job err", "pendingId", job.PendingId, "err", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	var spec params.JobCfg
+	if err = json.Unmarshal([]byte(job.Spec), &spec); err != nil {
+		finishPending(job, consts.PendingFailed, "", "invalid spec: "+err.Error())
+		return
+	}
+	res, code := createClusterModeJob(spec, placed)
+	switch {
+	case code.Code == utils.NoCapacity.Code:
+		if _, err = pendingDao.WithContext(context.Background()).UpdateStatus(job.ID, consts.PendingSubmitting, consts.PendingWaiting,
+			map[string]interface{}{"reason": PendingReasonCapacity, "last_error": code.Msg}); err != nil {
+			level.Error(log.Logger).Log("msg", "Requeue pending job err", "pendingId", job.PendingId, "err", err)
+		}
+	case code.Code != 0:
+		level.Warn(log.Logger).Log("msg", "Submit pending job fail", "pendingId", job.PendingId, "err", code.Msg)
+		finishPending(job, consts.PendingFailed, "", code.Msg)
+	default:
+		var jobId string
+		if data, ok := res.(map[string]interface{}); ok {
+			jobId, _ = data["id"].(string)
+		}
+		level.Info(log.Logger).Log("msg", "Pending job submitted", "pendingId", job.PendingId, "jobId", jobId)
+		finishPending(job, consts.PendingSubmitted, jobId, "")
+	}
+}
+
+func finishPending(job *entity.PendingJob, status int64, jobId, lastError string) {
+	var pendingDao = &dao.PendingJob{}
+	if _, err := pendingDao.WithContext(context.Background()).UpdateStatus(job.ID, consts.PendingSubmitting, status,
+		map[string]interface{}{"job_id": jobId, "last_error": lastError}); err != nil {
+		level.Error(log.Logger).Log("msg", "Update pending job err", "pendingId", job.PendingId, "err", err)
+	}
+}
+
+func failStalePending() {
+	var pendingDao = &dao.PendingJob{}
+	list, err := pendingDao.WithContext(context.Background()).ListStale(time.Now().Add(-pendingSubmitTimeout), pendingBatchSize)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "List stale pending jobs err", "err", err)
+		return
+	}
+	for i := range list {
+		level.Warn(log.Logger).Log("msg", "Pending job submit interrupted", "pendingId", list[i].PendingId)
+		finishPending(&list[i], consts.PendingFailed, "", "submit interrupted, job may have been created")
+	}
+}
+
+// CancelPending 取消等待中的任务, 已提交的任务不受影响
+func CancelPending(pendingId string) *utils.CodeType {
+	var pendingDao = &dao.PendingJob{}
+	job, code := findPending(pendingId)
+	if code.Code != 0 {
+		return code
+	}
+	if _, err := pendingDao.WithContext(context.Background()).UpdateStatus(job.ID, consts.PendingWaiting, consts.PendingCanceled, nil); err != nil {
+		level.Error(log.Logger).Log("CancelPending Err", err.Error())
+		return utils.DBErr
+	}
+	return &utils.CodeType{}
+}
+
+// PendingList 待提交任务列表, 按 id 游标分页
+func PendingList(req params.PendingList) (interface{}, *utils.CodeType) {
+	var pendingDao = &dao.PendingJob{}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	list, err := pendingDao.WithContext(context.Background()).List(req.Status, req.Cursor, limit+1)
+	if err != nil {
+		level.Error(log.Logger).Log("PendingList Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	hasMore := len(list) > limit
+	if hasMore {
+		list = list[:limit]
+	}
+	nextCursor := req.Cursor
+	if len(list) > 0 {
+		nextCursor = list[len(list)-1].ID
+	}
+	return map[string]interface{}{
+		"list":       list,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
+	}, &utils.CodeType{}
+}
+
+// PendingInfo 待提交任务详情
+func PendingInfo(req params.PendingInfo) (interface{}, *utils.CodeType) {
+	job, code := findPending(req.PendingId)
+	if code.Code != 0 {
+		return nil, code
+	}
+	return job, &utils.CodeType{}
+}
+
+func findPending(pendingId string) (*entity.PendingJob, *utils.CodeType) {
+	var pendingDao = &dao.PendingJob{}
+	job, err := pendingDao.WithContext(context.Background()).FindByPendingId(pendingId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByPendingId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if job.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+	return job, &utils.CodeType{}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/health"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	defaultListLimit = 20
+	detailEventLimit = 20
+	timeLayout       = "2006-01-02 15:04:05"
+)
+
+type JobDetail struct {
+	entity.Task
+	Tracked bool               `json:"tracked"`
+	Proc    *process.ProcStat  `json:"proc"`
+	Checks  []health.Result    `json:"checks"`
+	Events  []entity.TaskEvent `json:"events"`
+}
+
+// JobList 按条件分页查询任务列表
+func JobList(req params.JobList) (interface{}, *utils.CodeType) {
+	var (
+		taskDao = &dao.Task{}
+		filter  = dao.TaskFilter{
+			Node:   req.Node,
+			Dc:     req.Dc,
+			Ip:     req.Ip,
+			Status: req.Status,
+			BigOne: req.BigOne,
+		}
+		limit = req.Limit
+		err   error
+	)
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if req.DoOnce != nil {
+		doOnce := int64(consts.NotDoOnce)
+		if *req.DoOnce {
+			doOnce = consts.DoOnce
+		}
+		filter.DoOnce = &doOnce
+	}
+	if req.StartTime != "" {
+		if filter.StartTime, err = time.ParseInLocation(timeLayout, req.StartTime, time.Local); err != nil {
+			return nil, utils.ReqParamErr
+		}
+	}
+	if req.EndTime != "" {
+		if filter.EndTime, err = time.ParseInLocation(timeLayout, req.EndTime, time.Local); err != nil {
+			return nil, utils.ReqParamErr
+		}
+	}
+
+	// 多取一条用于判断是否还有下一页
+	list, err := taskDao.WithContext(context.Background()).List(filter, req.Cursor, limit+1)
+	if err != nil {
+		level.Error(log.Logger).Log("JobList Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	hasMore := len(list) > limit
+	if hasMore {
+		list = list[:limit]
+	}
+	nextCursor := req.Cursor
+	if len(list) > 0 {
+		nextCursor = list[len(list)-1].ID
+	}
+
+	return map[string]interface{}{
+		"list":       list,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
+	}, &utils.CodeType{}
+}
+
+// JobInfo 任务详情, 合并 DB 记录与进程实时状态
+func JobInfo(req params.JobInfo) (interface{}, *utils.CodeType) {
+	var taskDao = &dao.Task{}
+	info, err := taskDao.WithContext(context.Background()).GetByJobId(req.JobId)
+	if err != nil {
+		level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if info.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+
+	// 进程状态只能在任务所在节点获取
+	if val, ok := core.CoreConfig["singlemode"]; ok && !val.(bool) {
+		localNode, err := process.GetHostName()
+		if err != nil {
+			level.Error(log.Logger).Log("GetHostName Err", err.Error())
+			return nil, utils.ServerErr
+		}
+		if info.Node != localNode {
+			client, err := cluster.ClientFor(info.Node)
+			if err != nil {
+				level.Error(log.Logger).Log("GetWorkerInfo Err", err.Error())
+				return nil, cluster.CodeOf(err)
+			}
+			response, err := client.Info(context.Background(), req)
+			if err != nil {
+				level.Error(log.Logger).Log("msg", "Info on worker err", "node", info.Node, "err", err)
+				return nil, cluster.CodeOf(err)
+			}
+			return response, &utils.CodeType{}
+		}
+	}
+
+	return jobInfoLocal(info), &utils.CodeType{}
+}
+
+// JobInfoLocal 其他节点转发的查询, 只返回本节点的进程状态, 不再转发
+func JobInfoLocal(req params.JobInfo) (interface{}, *utils.CodeType) {
+	var taskDao = &dao.Task{}
+	info, err := taskDao.WithContext(context.Background()).GetByJobId(req.JobId)
+	if err != nil {
+		level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if info.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+	return jobInfoLocal(info), &utils.CodeType{}
+}
+
+func jobInfoLocal(info *entity.Task) *JobDetail {
+	detail := &JobDetail{Task: *info}
+	pid, tracked := process.PManager.JobExist(info.JobId)
+	detail.Tracked = tracked
+	if !tracked {
+		pid = info.Pid
+	}
+	detail.Proc = process.PManager.Stat(pid)
+	if health.HEngine != nil {
+		if results, state, ok := health.HEngine.Status(info.JobId); ok {
+			detail.Checks = results
+			detail.Health = state
+		}
+	}
+	var eventDao = &dao.TaskEvent{}
+	events, err := eventDao.WithContext(context.Background()).ListByJobId(info.JobId, detailEventLimit)
+	if err != nil {
+		level.Error(log.Logger).Log("ListByJobId Err", err.Error())
+	}
+	detail.Events = events
+	return detail
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	EventRebalance       = "rebalance"
+	EventRebalanceFailed = "rebalance-failed"
+
+	// 每个节点最多检查的候选任务数
+	rebalanceCandidateLimit = 100
+)
+
+// RebalanceMove 迁移计划中的一项
+type RebalanceMove struct {
+	cluster.Move
+	JobId string `json:"jobId"`
+
+	task *entity.Task
+}
+
+// RebalanceLoop leader 任务, 定期检查各节点负载, 差值超过阈值时迁移任务, 每轮最多迁移 maxMoves 个
+func RebalanceLoop(ctx context.Context) {
+	conf := cluster.GetRebalanceConfig()
+	ticker := time.NewTicker(time.Duration(conf.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if cluster.WkMg.View().Stale() {
+			level.Warn(log.Logger).Log("msg", "Cluster view is stale, skip rebalance")
+			continue
+		}
+		moves, err := planRebalance(conf)
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "Plan rebalance err", "err", err)
+			continue
+		}
+		for _, move := range moves {
+			if ctx.Err() != nil {
+				return
+			}
+			rebalanceTask(move)
+		}
+	}
+}
+
+// RebalancePlan 只计算迁移计划不执行, 用于查看 rebalance 会做什么
+func RebalancePlan() (interface{}, *utils.CodeType) {
+	if cluster.WkMg == nil {
+		return nil, utils.NotClusterMode
+	}
+	conf := cluster.GetRebalanceConfig()
+	moves, err := planRebalance(conf)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Plan rebalance err", "err", err)
+		return nil, utils.ServerErr
+	}
+	if moves == nil {
+		moves = []RebalanceMove{}
+	}
+	return map[string]interface{}{
+		"enabled":   conf.Enabled,
+		"metric":    conf.Metric,
+		"threshold": conf.Threshold,
+		"maxMoves":  conf.MaxMoves,
+		"stale":     cluster.WkMg.View().Stale(),
+		"moves":     moves,
+	}, &utils.CodeType{}
+}
+
+// planRebalance 按节点指标生成迁移计划, 并为每项挑选一个满足目标节点约束的可迁移任务
+func planRebalance(conf *cluster.RebalanceConfig) ([]RebalanceMove, error) {
+	workers, err := cluster.WkMg.View().Workers()
+	if err != nil {
+		return nil, err
+	}
+
+	// 注册信息中的任务数只统计本次启动后的变化, 以数据库为准; 只统计运行中的任务, 与可迁移的任务一致
+	var taskDao = &dao.Task{}
+	nodeStats, err := taskDao.WithContext(context.Background()).GetNodeRunningTaskCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := range workers {
+		workers[i].Resources.TaskCount = int(nodeStats[workers[i].Hostname])
+	}
+
+	var (
+		moves  []RebalanceMove
+		chosen = make(map[string]bool)
+	)
+	for _, move := range cluster.PlanRebalance(workers, conf) {
+		task, err := pickMovable(move, workers, chosen)
+		if err != nil {
+			return nil, err
+		}
+		if task == nil {
+			level.Info(log.Logger).Log("msg", "No movable task", "from", move.From, "to", move.To)
+			continue
+		}
+		chosen[task.JobId] = true
+		moves = append(moves, RebalanceMove{Move: move, JobId: task.JobId, task: task})
+	}
+	return moves, nil
+}
+
+// pickMovable 在 from 节点上挑选一个运行中、允许迁移且目标节点满足其约束的常驻任务
+func pickMovable(move cluster.Move, workers []cluster.Worker, chosen map[string]bool) (*entity.Task, error) {
+	var target *cluster.Worker
+	for i := range workers {
+		if workers[i].Hostname == move.To {
+			target = &workers[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, nil
+	}
+
+	var (
+		taskDao   = &dao.Task{}
+		running   = int64(consts.TaskStatusRunning)
+		notDoOnce = int64(consts.NotDoOnce)
+		movable   = int64(consts.Movable)
+		bigOne    = false
+		filter    = dao.TaskFilter{Node: move.From, Status: &running, DoOnce: &notDoOnce, Movable: &movable, BigOne: &bigOne}
+	)
+	list, err := taskDao.WithContext(context.Background()).List(filter, 0, rebalanceCandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if chosen[list[i].JobId] {
+			continue
+		}
+		spec := taskSpec(&list[i])
+		if spec.Node != "" {
+			continue
+		}
+		if cluster.MatchConstraints(scheduleRequest(spec), target) != nil {
+			continue
+		}
+		return &list[i], nil
+	}
+	return nil, nil
+}
+
+// rebalanceTask 先修改归属, 再停止原节点进程, 最后在目标节点拉起
+// 原节点停止失败时恢复归属, 避免同一任务在两个节点运行
+func rebalanceTask(move RebalanceMove) bool {
+	var (
+		taskDao = &dao.Task{}
+		task    = move.task
+	)
+
+	ok, err := moveTask(task, move.From, move.To)
+	if err != nil || !ok {
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "MoveNode Err", "jobId", task.JobId, "err", err)
+		}
+		return false
+	}
+
+	if err = releaseOn(move.From, task.JobId); err != nil {
+		msg := fmt.Sprintf("rebalance release on %s: %s", move.From, err.Error())
+		level.Error(log.Logger).Log("msg", "Rebalance task fail", "jobId", task.JobId, "err", msg)
+		if ok, _ := taskDao.WithContext(context.Background()).MoveNode(task.ID, move.To, move.From, task.Dc, task.Ip); ok {
+			_ = taskDao.WithContext(context.Background()).UpdatePid(task.ID, task.Pid, task.ProcStartTime, task.Token)
+		}
+		recordEvent(task.JobId, EventRebalanceFailed, move.From, move.To, msg)
+		return false
+	}
+
+	if err = adoptOn(move.To, task); err != nil {
+		msg := fmt.Sprintf("rebalance from %s to %s: %s", move.From, move.To, err.Error())
+		level.Error(log.Logger).Log("msg", "Rebalance task fail", "jobId", task.JobId, "err", msg)
+		_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusFailed, process.OutcomeLost, msg)
+		recordEvent(task.JobId, EventRebalanceFailed, move.From, move.To, msg)
+		return false
+	}
+
+	level.Info(log.Logger).Log("msg", "Task rebalanced", "jobId", task.JobId, "from", move.From, "to", move.To)
+	recordEvent(task.JobId, EventRebalance, move.From, move.To, "")
+	return true
+}
+
+func releaseOn(node, jobId string) error {
+	localNode, err := process.GetHostName()
+	if err != nil {
+		return err
+	}
+	if node == localNode {
+		releaseLocal(jobId)
+		return nil
+	}
+	client, err := cluster.ClientFor(node)
+	if err != nil {
+		return err
+	}
+	return client.Release(context.Background(), jobId)
+}
+
+// ReleaseJob 停止本节点上已迁移到其他节点的任务进程, 保留任务记录
+func ReleaseJob(jobId string) (interface{}, *utils.CodeType) {
+	var taskDao = &dao.Task{}
+	task, err := taskDao.WithContext(context.Background()).GetByJobId(jobId)
+	if err != nil {
+		level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if task.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+
+	localNode, err := process.GetHostName()
+	if err != nil {
+		level.Error(log.Logger).Log("GetHostName Err", err.Error())
+		return nil, utils.ServerErr
+	}
+	// 仍属于本节点的任务应通过 stop 接口停止
+	if task.Node == localNode {
+		level.Warn(log.Logger).Log("msg", "Release task still owned by local node", "jobId", jobId)
+		return nil, utils.ReqParamErr
+	}
+
+	releaseLocal(jobId)
+	return map[string]interface{}{"id": jobId, "node": task.Node}, &utils.CodeType{}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"time"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// RecoverJobs 守护进程重启后, 根据本节点的 task 记录重建进程表
+// pid 仍属于该任务的进程直接接管, 否则按重启策略重新拉起
+func RecoverJobs() error {
+	var (
+		batchSize = 1000
+		taskDao   = &dao.Task{}
+		cursor    int64
+		adopted   int
+		restarted int
+	)
+
+	hostName, err := process.GetHostName()
+	if err != nil {
+		return err
+	}
+
+	filter := dao.TaskFilter{Node: hostName}
+	for {
+		list, err := taskDao.WithContext(context.Background()).List(filter, cursor, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			break
+		}
+		cursor = list[len(list)-1].ID
+
+		for _, task := range list {
+			// 普通一次性任务同步执行, 没有常驻进程
+			if task.DoOnce == consts.DoOnce && task.BigOne != consts.BigOne {
+				continue
+			}
+			// 显式配置 always 的任务非主动停止时, 守护进程重启后重新拉起; 主动停止的任务及未配置策略的任务保持停止
+			if task.Status == consts.TaskStatusStopped && task.DoOnce == consts.NotDoOnce &&
+				task.Outcome != process.OutcomeStopped && taskSpec(&task).Restart == process.RestartAlways {
+				level.Info(log.Logger).Log("msg", "Starting stopped task with restart=always", "jobId", task.JobId)
+				if restartTask(&task) == nil {
+					_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusRunning, task.Outcome, task.LastError)
+					restarted++
+				}
+				continue
+			}
+			if task.Status != consts.TaskStatusRunning {
+				continue
+			}
+			switch recoverTask(&task) {
+			case recoverAdopted:
+				adopted++
+			case recoverRestarted:
+				restarted++
+			}
+		}
+
+		if len(list) < batchSize {
+			break
+		}
+	}
+
+	level.Info(log.Logger).Log("msg", "Recover jobs finished", "node", hostName,
+		"adopted", adopted, "restarted", restarted)
+	return nil
+}
+
+// recoverTask 的处理结果
+const (
+	recoverNone = iota
+	recoverAdopted
+	recoverRestarted
+)
+
+// recoverTask 优先接管原进程, 否则按重启策略处理
+func recoverTask(task *entity.Task) int {
+	var taskDao = &dao.Task{}
+	if process.PManager.VerifyOwner(task.Pid, task.JobId, task.Token, task.ProcStartTime) {
+		process.PManager.Adopt(task.JobId, task.Pid)
+		// 最长运行时间从进程实际启动时计算
+		start, spec := time.Now(), taskSpec(task)
+		if task.ProcStartTime > 0 {
+			start = time.UnixMilli(task.ProcStartTime)
+		}
+		applyLimits(task.JobId, spec, start)
+		watchHealth(task.JobId, spec)
+		level.Info(log.Logger).Log("msg", "Adopt running task", "jobId", task.JobId, "pid", task.Pid)
+		return recoverAdopted
+	}
+
+	// 一次性任务不再拉起
+	if task.DoOnce == consts.DoOnce {
+		level.Info(log.Logger).Log("msg", "BigOne task exited during restart", "jobId", task.JobId, "pid", task.Pid)
+		return recoverNone
+	}
+
+	// 守护进程停止期间退出的进程, 退出状态未知
+	lost := process.ExitEvent{JobId: task.JobId, Pid: task.Pid, ExitCode: -1, EndTime: time.Now()}
+	if !restartPolicy(taskSpec(task)).ShouldRestart(lost) {
+		level.Info(log.Logger).Log("msg", "Lost task not restarted by policy", "jobId", task.JobId, "pid", task.Pid)
+		_ = taskDao.WithContext(context.Background()).UpdateExit(task.ID, consts.TaskStatusFailed,
+			process.OutcomeLost, exitDesc(lost)+"; process lost while wsystemd was down")
+		return recoverNone
+	}
+
+	level.Info(log.Logger).Log("msg", "Restarting lost task", "jobId", task.JobId, "pid", task.Pid)
+	if restartTask(task) != nil {
+		return recoverNone
+	}
+	_ = taskDao.WithContext(context.Background()).IncrRetryCount(task.ID)
+	return recoverRestarted
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// CreateService 多副本任务, 创建 Num 个共享 parent_id 的副本, 集群模式下每个副本单独调度
+func CreateService(req params.JobCfg) (interface{}, *utils.CodeType) {
+	var (
+		serviceDao = &dao.JobService{}
+		serviceId  = utils.GetID(32)
+		now        = time.Now()
+	)
+	spec, err := json.Marshal(req)
+	if err != nil {
+		return nil, utils.ReqParamErr
+	}
+
+	model := entity.JobService{
+		ServiceId:  serviceId,
+		Spec:       string(spec),
+		Replicas:   req.Num,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err = serviceDao.WithContext(context.Background()).Create(&model); err != nil {
+		level.Error(log.Logger).Log("CreateService Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	return map[string]interface{}{
+		"id":       serviceId,
+		"ctime":    utils.GetCTime(),
+		"replicas": startReplicas(req, serviceId, 0, req.Num),
+	}, &utils.CodeType{}
+}
+
+// startReplicas 启动序号 [from, to) 的副本, 单个副本失败不影响其他副本
+func startReplicas(req params.JobCfg, serviceId string, from, to int) []interface{} {
+	results := make([]interface{}, 0, to-from)
+	for i := from; i < to; i++ {
+		replica := req
+		replica.Num = 1
+		replica.ParentId = serviceId
+		replica.Replica = i
+		res, codeType := CreateClusterModeJob(replica)
+		if codeType.Code != 0 {
+			level.Error(log.Logger).Log("msg", "Start replica fail", "serviceId", serviceId, "replica", i, "err", codeType.Msg)
+			results = append(results, map[string]interface{}{"replica": i, "error": codeType.Msg})
+			continue
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// ScaleService 调整副本数, 缩容时优先停止序号大的副本
+func ScaleService(serviceId string, num int) (interface{}, *utils.CodeType) {
+	var (
+		serviceDao = &dao.JobService{}
+		taskDao    = &dao.Task{}
+	)
+	svc, err := serviceDao.WithContext(context.Background()).FindByServiceId(serviceId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByServiceId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if svc.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+
+	var spec params.JobCfg
+	if err = json.Unmarshal([]byte(svc.Spec), &spec); err != nil {
+		level.Error(log.Logger).Log("Invalid service spec", err.Error(), "serviceId", serviceId)
+		return nil, utils.ServerErr
+	}
+
+	list, err := taskDao.WithContext(context.Background()).ListByParentId(serviceId)
+	if err != nil {
+		level.Error(log.Logger).Log("ListByParentId Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	var changes []interface{}
+	if num > len(list) {
+		next := 0
+		if len(list) > 0 {
+			next = list[len(list)-1].Replica + 1
+		}
+		changes = startReplicas(spec, serviceId, next, next+num-len(list))
+	}
+	for i := len(list) - 1; i >= num; i-- {
+		changes = append(changes, stopReplica(&list[i]))
+	}
+
+	if err = serviceDao.WithContext(context.Background()).UpdateReplicas(serviceId, num); err != nil {
+		level.Error(log.Logger).Log("UpdateReplicas Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	return map[string]interface{}{
+		"id":       serviceId,
+		"replicas": num,
+		"changes":  changes,
+	}, &utils.CodeType{}
+}
+
+func stopReplica(task *entity.Task) map[string]interface{} {
+	res := map[string]interface{}{"replica": task.Replica, "id": task.JobId, "stopped": true}
+	codeType := StopSingleModeJob(task.JobId, true)
+	if codeType == utils.StopNotExist {
+		// 已退出且不再重启的副本, 直接删除记录
+		var taskDao = &dao.Task{}
+		if err := taskDao.WithContext(context.Background()).DeleteByJobId(task.JobId); err != nil {
+			level.Error(log.Logger).Log("DeleteByJobId Err", err.Error())
+			codeType = utils.DBErr
+		} else {
+			codeType = &utils.CodeType{}
+		}
+	}
+	if codeType.Code != 0 {
+		res["stopped"] = false
+		res["error"] = codeType.Msg
+	}
+	return res
+}
+
+// StopService 停止全部副本并删除服务
+func StopService(serviceId string) *utils.CodeType {
+	if _, codeType := ScaleService(serviceId, 0); codeType.Code != 0 {
+		return codeType
+	}
+	var serviceDao = &dao.JobService{}
+	if err := serviceDao.WithContext(context.Background()).DeleteByServiceId(serviceId); err != nil {
+		level.Error(log.Logger).Log("DeleteByServiceId Err", err.Error())
+		return utils.DBErr
+	}
+	return &utils.CodeType{}
+}
+
+// ServiceInfo 服务及其副本列表
+func ServiceInfo(req params.ServiceInfo) (interface{}, *utils.CodeType) {
+	var (
+		serviceDao = &dao.JobService{}
+		taskDao    = &dao.Task{}
+	)
+	svc, err := serviceDao.WithContext(context.Background()).FindByServiceId(req.ServiceId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByServiceId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if svc.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+	list, err := taskDao.WithContext(context.Background()).ListByParentId(req.ServiceId)
+	if err != nil {
+		level.Error(log.Logger).Log("ListByParentId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	return map[string]interface{}{
+		"service":   svc,
+		"instances": list,
+	}, &utils.CodeType{}
+}
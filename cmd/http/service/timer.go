@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"wsystemd/cmd/dispatch"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	EventTimer = "timer"
+
+	timerTickInterval = time.Second
+	timerBatchSize    = 100
+	// 晚于触发时间超过该值视为错过, 按 missed 策略处理
+	timerMisfireTolerance = 30 * time.Second
+)
+
+// timerBusy 正在创建任务的定时器, 用于 forbid/replace 判断
+var timerBusy sync.Map
+
+// TimerLoop 定期检查到期的定时器, 集群模式下作为 leader 任务运行
+// 每次触发先通过 version 抢占, 抢占成功才创建任务, 保证每次触发只执行一次
+func TimerLoop(ctx context.Context) {
+	ticker := time.NewTicker(timerTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var timerDao = &dao.JobTimer{}
+		now := time.Now()
+		list, err := timerDao.WithContext(context.Background()).ListDue(now, timerBatchSize)
+		if err != nil {
+			level.Error(log.Logger).Log("msg", "List due timers err", "err", err)
+			continue
+		}
+		for i := range list {
+			if ctx.Err() != nil {
+				return
+			}
+			fireTimer(list[i], now)
+		}
+	}
+}
+
+func fireTimer(timer entity.JobTimer, now time.Time) {
+	var timerDao = &dao.JobTimer{}
+	schedule, err := timerSchedule(&timer)
+	if err != nil {
+		// 已保存的定时器解析失败只可能是数据被修改, 暂停避免每秒重复报错
+		level.Error(log.Logger).Log("msg", "Parse timer schedule err", "timerId", timer.TimerId, "err", err)
+		if err := timerDao.WithContext(context.Background()).UpdateStatus(timer.ID, consts.TimerPaused, time.Time{}); err != nil {
+			level.Error(log.Logger).Log("msg", "Pause timer err", "timerId", timer.TimerId, "err", err)
+		}
+		return
+	}
+
+	plan := dispatch.Due(schedule, timer.MissedPolicy, timer.NextRunTime, now, timerMisfireTolerance)
+	var fireTime time.Time
+	if plan.Run {
+		fireTime = plan.FireTime
+	}
+	claimed, err := timerDao.WithContext(context.Background()).Claim(timer.ID, timer.Version, fireTime, plan.Next)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Claim timer err", "timerId", timer.TimerId, "err", err)
+		return
+	}
+	if !claimed {
+		// 已被其他节点处理或被暂停/修改
+		return
+	}
+	if !plan.Run {
+		level.Warn(log.Logger).Log("msg", "Timer missed, skip", "timerId", timer.TimerId, "scheduled", timer.NextRunTime, "next", plan.Next)
+		return
+	}
+	go runTimer(timer, plan.FireTime)
+}
+
+// runTimer 按并发策略创建本次触发的任务并记录结果
+func runTimer(timer entity.JobTimer, fireTime time.Time) {
+	var spec params.JobCfg
+	if err := json.Unmarshal([]byte(timer.Spec), &spec); err != nil {
+		level.Error(log.Logger).Log("msg", "Unmarshal timer spec err", "timerId", timer.TimerId, "err", err)
+		updateTimerResult(timer, "", err.Error())
+		return
+	}
+
+	if timer.ConcurrencyPolicy != dispatch.ConcurrencyAllow && timerRunning(timer) {
+		// doOnce 任务的执行无法中途停止, 按 forbid 处理
+		if timer.ConcurrencyPolicy == dispatch.ConcurrencyForbid || spec.DoOnce || timer.LastJobId == "" {
+			level.Warn(log.Logger).Log("msg", "Last timer job still running, skip", "timerId", timer.TimerId, "jobId", timer.LastJobId)
+			updateTimerResult(timer, "", fmt.Sprintf("skipped at %s: last job %s still running", fireTime.Format(timeLayout), timer.LastJobId))
+			return
+		}
+		if code := StopSingleModeJob(timer.LastJobId, true); code.Code != 0 {
+			level.Error(log.Logger).Log("msg", "Replace timer job err", "timerId", timer.TimerId, "jobId", timer.LastJobId, "err", code.Msg)
+			updateTimerResult(timer, "", "stop last job fail: "+code.Msg)
+			return
+		}
+	}
+
+	timerBusy.Store(timer.TimerId, true)
+	defer timerBusy.Delete(timer.TimerId)
+
+	res, code := CreateClusterModeJob(spec)
+	if code.Code != 0 {
+		level.Error(log.Logger).Log("msg", "Run timer job err", "timerId", timer.TimerId, "err", code.Msg)
+		updateTimerResult(timer, "", code.Msg)
+		return
+	}
+	jobId := ""
+	if data, ok := res.(map[string]interface{}); ok {
+		jobId, _ = data["id"].(string)
+	}
+	level.Info(log.Logger).Log("msg", "Timer fired", "timerId", timer.TimerId, "fireTime", fireTime, "jobId", jobId)
+	if jobId != "" && !spec.DoOnce {
+		recordEvent(jobId, EventTimer, "", "", fmt.Sprintf("started by timer %s at %s", timer.TimerId, fireTime.Format(timeLayout)))
+	}
+	updateTimerResult(timer, jobId, "")
+}
+
+// timerRunning 上一次触发的任务是否仍在运行
+func timerRunning(timer entity.JobTimer) bool {
+	if _, ok := timerBusy.Load(timer.TimerId); ok {
+		return true
+	}
+	if timer.LastJobId == "" {
+		return false
+	}
+	var (
+		taskDao = &dao.Task{}
+		execDao = &dao.JobExecution{}
+	)
+	task, err := taskDao.WithContext(context.Background()).GetByJobId(timer.LastJobId)
+	if err != nil {
+		level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+		return false
+	}
+	if task.ID > 0 {
+		return task.Status == consts.TaskStatusRunning
+	}
+	// doOnce 任务记录在 job_execution
+	execution, err := execDao.WithContext(context.Background()).FindByExecId(timer.LastJobId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByExecId Err", err.Error())
+		return false
+	}
+	return execution.ID > 0 && execution.Status < consts.ExecStatusSucceeded
+}
+
+func updateTimerResult(timer entity.JobTimer, jobId, lastError string) {
+	var timerDao = &dao.JobTimer{}
+	if err := timerDao.WithContext(context.Background()).UpdateLastJob(timer.ID, jobId, lastError); err != nil {
+		level.Error(log.Logger).Log("msg", "Update timer result err", "timerId", timer.TimerId, "err", err)
+	}
+}
+
+func timerSchedule(timer *entity.JobTimer) (dispatch.Schedule, error) {
+	var runAt time.Time
+	if timer.RunAt != nil {
+		runAt = *timer.RunAt
+	}
+	return dispatch.Parse(timer.ScheduleType, timer.Cron, timer.IntervalSec, runAt)
+}
+
+// CreateTimer 创建定时器, 第一次触发时间按当前时间计算
+func CreateTimer(req params.TimerCfg) (interface{}, *utils.CodeType) {
+	var (
+		timerDao = &dao.JobTimer{}
+		now      = time.Now()
+		model    = entity.JobTimer{
+			TimerId:           utils.GetID(32),
+			Name:              req.Name,
+			Cron:              req.Cron,
+			IntervalSec:       req.Interval,
+			MissedPolicy:      req.Missed,
+			ConcurrencyPolicy: req.Concurrency,
+			Status:            consts.TimerActive,
+			CreateTime:        now,
+			UpdateTime:        now,
+		}
+	)
+	switch {
+	case req.Cron != "":
+		model.ScheduleType = dispatch.TypeCron
+	case req.Interval > 0:
+		model.ScheduleType = dispatch.TypeInterval
+	default:
+		runAt, err := time.ParseInLocation(timeLayout, req.RunAt, time.Local)
+		if err != nil {
+			return nil, utils.ReqParamErr
+		}
+		model.ScheduleType = dispatch.TypeOnce
+		model.RunAt = &runAt
+	}
+	if model.MissedPolicy == "" {
+		model.MissedPolicy = dispatch.MissedSkip
+	}
+	if model.ConcurrencyPolicy == "" {
+		model.ConcurrencyPolicy = dispatch.ConcurrencyForbid
+	}
+
+	schedule, err := timerSchedule(&model)
+	if err != nil {
+		level.Warn(log.Logger).Log("msg", "Invalid timer schedule", "cron", req.Cron, "err", err)
+		return nil, utils.ReqParamErr
+	}
+	model.NextRunTime = dispatch.First(schedule, now)
+	if model.NextRunTime.IsZero() {
+		return nil, utils.ReqParamErr
+	}
+
+	spec, err := json.Marshal(req.Job)
+	if err != nil {
+		return nil, utils.ReqParamErr
+	}
+	model.Spec = string(spec)
+
+	if err := timerDao.WithContext(context.Background()).Create(&model); err != nil {
+		level.Error(log.Logger).Log("CreateTimer Err", err.Error())
+		return nil, utils.DBErr
+	}
+	return model, &utils.CodeType{}
+}
+
+// TimerList 定时器列表, 按 id 游标分页
+func TimerList(req params.TimerList) (interface{}, *utils.CodeType) {
+	var timerDao = &dao.JobTimer{}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	list, err := timerDao.WithContext(context.Background()).List(req.Cursor, limit+1)
+	if err != nil {
+		level.Error(log.Logger).Log("TimerList Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	hasMore := len(list) > limit
+	if hasMore {
+		list = list[:limit]
+	}
+	nextCursor := req.Cursor
+	if len(list) > 0 {
+		nextCursor = list[len(list)-1].ID
+	}
+	return map[string]interface{}{
+		"list":       list,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
+	}, &utils.CodeType{}
+}
+
+// TimerInfo 定时器详情及上一次触发的任务
+func TimerInfo(req params.TimerInfo) (interface{}, *utils.CodeType) {
+	timer, code := findTimer(req.TimerId)
+	if code.Code != 0 {
+		return nil, code
+	}
+	res := map[string]interface{}{"timer": timer}
+	if timer.LastJobId != "" {
+		var taskDao = &dao.Task{}
+		task, err := taskDao.WithContext(context.Background()).GetByJobId(timer.LastJobId)
+		if err != nil {
+			level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+			return nil, utils.DBErr
+		}
+		if task.ID > 0 {
+			res["lastJob"] = task
+		} else if execution, code := findExecution(timer.LastJobId); code.Code == 0 {
+			res["lastExecution"] = execution
+		}
+	}
+	return res, &utils.CodeType{}
+}
+
+// PauseTimer 暂停触发, 已创建的任务不受影响
+func PauseTimer(timerId string) *utils.CodeType {
+	timer, code := findTimer(timerId)
+	if code.Code != 0 {
+		return code
+	}
+	if timer.Status != consts.TimerActive {
+		return &utils.CodeType{}
+	}
+	var timerDao = &dao.JobTimer{}
+	if err := timerDao.WithContext(context.Background()).UpdateStatus(timer.ID, consts.TimerPaused, time.Time{}); err != nil {
+		level.Error(log.Logger).Log("PauseTimer Err", err.Error())
+		return utils.DBErr
+	}
+	return &utils.CodeType{}
+}
+
+// ResumeTimer 恢复触发, 暂停期间的触发不补执行
+func ResumeTimer(timerId string) *utils.CodeType {
+	timer, code := findTimer(timerId)
+	if code.Code != 0 {
+		return code
+	}
+	if timer.Status != consts.TimerPaused {
+		return &utils.CodeType{}
+	}
+	schedule, err := timerSchedule(timer)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Parse timer schedule err", "timerId", timerId, "err", err)
+		return utils.ReqParamErr
+	}
+	status, next := int64(consts.TimerActive), dispatch.First(schedule, time.Now())
+	if next.IsZero() {
+		status = consts.TimerFinished
+	}
+	var timerDao = &dao.JobTimer{}
+	if err := timerDao.WithContext(context.Background()).UpdateStatus(timer.ID, status, next); err != nil {
+		level.Error(log.Logger).Log("ResumeTimer Err", err.Error())
+		return utils.DBErr
+	}
+	return &utils.CodeType{}
+}
+
+// StopTimer 删除定时器, 已创建的任务需单独停止
+func StopTimer(timerId string) *utils.CodeType {
+	if _, code := findTimer(timerId); code.Code != 0 {
+		return code
+	}
+	var timerDao = &dao.JobTimer{}
+	if err := timerDao.WithContext(context.Background()).DeleteByTimerId(timerId); err != nil {
+		level.Error(log.Logger).Log("DeleteByTimerId Err", err.Error())
+		return utils.DBErr
+	}
+	return &utils.CodeType{}
+}
+
+func findTimer(timerId string) (*entity.JobTimer, *utils.CodeType) {
+	var timerDao = &dao.JobTimer{}
+	timer, err := timerDao.WithContext(context.Background()).FindByTimerId(timerId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByTimerId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if timer.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+	return timer, &utils.CodeType{}
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+	"wsystemd/cmd/health"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/dto/dao"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+	"wsystemd/cmd/utils"
+	"wsystemd/cmd/workflow"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	workflowTickInterval = 2 * time.Second
+	workflowBatchSize    = 100
+	// 步骤已抢占但任务 ID 未写入(如创建任务时 leader 退出)超过该时间视为启动失败
+	workflowStartTimeout = 5 * time.Minute
+)
+
+// WorkflowLoop 定期推进运行中的工作流, 集群模式下作为 leader 任务运行
+// 步骤状态通过条件更新抢占, leader 切换时同一步骤也只会启动一次
+func WorkflowLoop(ctx context.Context) {
+	ticker := time.NewTicker(workflowTickInterval)
+	defer ticker.Stop()
+
+	status := int64(workflow.StatusRunning)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var (
+			workflowDao = &dao.Workflow{}
+			cursor      int64
+		)
+		for {
+			list, err := workflowDao.WithContext(context.Background()).List(&status, cursor, workflowBatchSize)
+			if err != nil {
+				level.Error(log.Logger).Log("msg", "List running workflows err", "err", err)
+				break
+			}
+			for i := range list {
+				if ctx.Err() != nil {
+					return
+				}
+				advanceWorkflow(&list[i])
+			}
+			if len(list) < workflowBatchSize {
+				break
+			}
+			cursor = list[len(list)-1].ID
+		}
+	}
+}
+
+func advanceWorkflow(wf *entity.Workflow) {
+	var workflowDao = &dao.Workflow{}
+	steps, err := workflowDao.WithContext(context.Background()).ListSteps(wf.WorkflowId)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "List workflow steps err", "workflowId", wf.WorkflowId, "err", err)
+		return
+	}
+
+	var (
+		nodes  = make([]workflow.Step, 0, len(steps))
+		byName = make(map[string]*entity.WorkflowStep, len(steps))
+	)
+	for i := range steps {
+		step := &steps[i]
+		byName[step.Name] = step
+		if step.Status == workflow.StepRunning {
+			refreshStep(step)
+		}
+		nodes = append(nodes, workflow.Step{
+			Name:      step.Name,
+			DependsOn: stepDeps(step),
+			OnFailure: step.OnFailure,
+			Status:    int(step.Status),
+		})
+	}
+
+	plan, err := workflow.Advance(nodes)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Advance workflow err", "workflowId", wf.WorkflowId, "err", err)
+		finishWorkflow(wf, workflow.StatusFailed, err.Error())
+		return
+	}
+	for _, name := range plan.Cancel {
+		setStepStatus(byName[name], workflow.StepCanceled, "workflow failed")
+	}
+	for _, name := range plan.Skip {
+		setStepStatus(byName[name], workflow.StepSkipped, "upstream failed or skipped")
+	}
+	for _, name := range plan.Start {
+		startStep(byName[name])
+	}
+	if !plan.Done {
+		return
+	}
+
+	if plan.Failed {
+		var failed []string
+		for _, step := range steps {
+			if step.Status == workflow.StepFailed {
+				failed = append(failed, step.Name)
+			}
+		}
+		finishWorkflow(wf, workflow.StatusFailed, "step failed: "+strings.Join(failed, ", "))
+		return
+	}
+	finishWorkflow(wf, workflow.StatusSucceeded, "")
+}
+
+// refreshStep 按任务或执行的状态更新已启动的步骤
+// 常驻任务运行且健康(没有健康检查时运行即可)后为 ready, 一次性任务执行成功后为 succeeded
+func refreshStep(step *entity.WorkflowStep) {
+	if step.JobId == "" {
+		if step.StartTime != nil && time.Since(*step.StartTime) > workflowStartTimeout {
+			setStepStatus(step, workflow.StepFailed, "job was not created")
+		}
+		return
+	}
+
+	var (
+		spec    = stepSpec(step)
+		taskDao = &dao.Task{}
+		execDao = &dao.JobExecution{}
+	)
+	if spec.DoOnce && spec.BigOne == "" {
+		execution, err := execDao.WithContext(context.Background()).FindByExecId(step.JobId)
+		if err != nil {
+			level.Error(log.Logger).Log("FindByExecId Err", err.Error())
+			return
+		}
+		switch {
+		case execution.ID <= 0:
+			setStepStatus(step, workflow.StepFailed, "execution not found")
+		case execution.Status == consts.ExecStatusSucceeded:
+			setStepStatus(step, workflow.StepSucceeded, "")
+		case execution.Status == consts.ExecStatusFailed:
+			setStepStatus(step, workflow.StepFailed, execution.Outcome+": "+execution.LastError)
+		}
+		return
+	}
+
+	task, err := taskDao.WithContext(context.Background()).GetByJobId(step.JobId)
+	if err != nil {
+		level.Error(log.Logger).Log("GetByJobId Err", err.Error())
+		return
+	}
+	switch {
+	case task.ID <= 0:
+		setStepStatus(step, workflow.StepFailed, "job was stopped")
+	case task.Status == consts.TaskStatusFailed:
+		setStepStatus(step, workflow.StepFailed, task.Outcome+": "+task.LastError)
+	case task.Status == consts.TaskStatusStopped:
+		// restart=no 的任务正常退出视为完成
+		if task.Outcome == process.OutcomeSuccess {
+			setStepStatus(step, workflow.StepSucceeded, "")
+		} else {
+			setStepStatus(step, workflow.StepFailed, task.Outcome+": "+task.LastError)
+		}
+	case len(spec.Checks) == 0 || task.Health == health.StateHealthy:
+		setStepStatus(step, workflow.StepReady, "")
+	}
+}
+
+// startStep 抢占等待中的步骤并创建任务
+func startStep(step *entity.WorkflowStep) {
+	var (
+		workflowDao = &dao.Workflow{}
+		now         = time.Now()
+	)
+	claimed, err := workflowDao.WithContext(context.Background()).UpdateStep(step.ID, workflow.StepPending, workflow.StepRunning,
+		map[string]interface{}{"start_time": now})
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Claim workflow step err", "workflowId", step.WorkflowId, "step", step.Name, "err", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	step.Status, step.StartTime = workflow.StepRunning, &now
+
+	res, code := CreateClusterModeJob(stepSpec(step))
+	if code.Code != 0 {
+		level.Error(log.Logger).Log("msg", "Start workflow step err", "workflowId", step.WorkflowId, "step", step.Name, "err", code.Msg)
+		setStepStatus(step, workflow.StepFailed, code.Msg)
+		return
+	}
+	if data, ok := res.(map[string]interface{}); ok {
+		step.JobId, _ = data["id"].(string)
+	}
+	if _, err = workflowDao.WithContext(context.Background()).UpdateStep(step.ID, workflow.StepRunning, workflow.StepRunning,
+		map[string]interface{}{"job_id": step.JobId}); err != nil {
+		level.Error(log.Logger).Log("msg", "Update workflow step job err", "workflowId", step.WorkflowId, "step", step.Name, "err", err)
+	}
+	level.Info(log.Logger).Log("msg", "Workflow step started", "workflowId", step.WorkflowId, "step", step.Name, "jobId", step.JobId)
+}
+
+func setStepStatus(step *entity.WorkflowStep, status int64, lastError string) {
+	var (
+		workflowDao = &dao.Workflow{}
+		updates     = map[string]interface{}{"last_error": lastError}
+	)
+	if status != workflow.StepReady {
+		updates["end_time"] = time.Now()
+	}
+	ok, err := workflowDao.WithContext(context.Background()).UpdateStep(step.ID, step.Status, status, updates)
+	if err != nil {
+		level.Error(log.Logger).Log("msg", "Update workflow step err", "workflowId", step.WorkflowId, "step", step.Name, "err", err)
+		return
+	}
+	if ok {
+		step.Status, step.LastError = status, lastError
+	}
+}
+
+func finishWorkflow(wf *entity.Workflow, status int64, lastError string) {
+	var workflowDao = &dao.Workflow{}
+	if _, err := workflowDao.WithContext(context.Background()).UpdateStatus(wf.ID, workflow.StatusRunning, status, lastError); err != nil {
+		level.Error(log.Logger).Log("msg", "Finish workflow err", "workflowId", wf.WorkflowId, "err", err)
+		return
+	}
+	level.Info(log.Logger).Log("msg", "Workflow finished", "workflowId", wf.WorkflowId, "status", status, "err", lastError)
+}
+
+func stepSpec(step *entity.WorkflowStep) params.JobCfg {
+	var spec params.JobCfg
+	if err := json.Unmarshal([]byte(step.Spec), &spec); err != nil {
+		level.Warn(log.Logger).Log("msg", "Invalid workflow step spec", "workflowId", step.WorkflowId, "step", step.Name, "err", err)
+	}
+	return spec
+}
+
+func stepDeps(step *entity.WorkflowStep) []string {
+	var deps []string
+	if step.DependsOn != "" {
+		_ = json.Unmarshal([]byte(step.DependsOn), &deps)
+	}
+	return deps
+}
+
+// WorkflowSteps 将请求转换为依赖图节点, 用于提交前校验
+func WorkflowSteps(req params.WorkflowCfg) []workflow.Step {
+	steps := make([]workflow.Step, 0, len(req.Steps))
+	for _, step := range req.Steps {
+		steps = append(steps, workflow.Step{Name: step.Name, DependsOn: step.DependsOn, OnFailure: step.OnFailure})
+	}
+	return steps
+}
+
+// CreateWorkflow 保存工作流及步骤, 由 WorkflowLoop 按依赖关系启动
+func CreateWorkflow(req params.WorkflowCfg) (interface{}, *utils.CodeType) {
+	if err := workflow.Validate(WorkflowSteps(req)); err != nil {
+		return nil, utils.ReqParamErr
+	}
+	var (
+		workflowDao = &dao.Workflow{}
+		now         = time.Now()
+		model       = entity.Workflow{
+			WorkflowId: utils.GetID(32),
+			Name:       req.Name,
+			Status:     workflow.StatusRunning,
+			CreateTime: now,
+			UpdateTime: now,
+		}
+		steps = make([]entity.WorkflowStep, 0, len(req.Steps))
+	)
+	for _, step := range req.Steps {
+		spec, err := json.Marshal(step.Job)
+		if err != nil {
+			return nil, utils.ReqParamErr
+		}
+		deps, _ := json.Marshal(step.DependsOn)
+		onFailure := step.OnFailure
+		if onFailure == "" {
+			onFailure = workflow.OnFailureFail
+		}
+		steps = append(steps, entity.WorkflowStep{
+			WorkflowId: model.WorkflowId,
+			Name:       step.Name,
+			DependsOn:  string(deps),
+			OnFailure:  onFailure,
+			Spec:       string(spec),
+			Status:     workflow.StepPending,
+			CreateTime: now,
+			UpdateTime: now,
+		})
+	}
+	if err := workflowDao.WithContext(context.Background()).CreateWithSteps(&model, steps); err != nil {
+		level.Error(log.Logger).Log("CreateWorkflow Err", err.Error())
+		return nil, utils.DBErr
+	}
+	return map[string]interface{}{
+		"workflow": model,
+		"steps":    steps,
+	}, &utils.CodeType{}
+}
+
+// CancelWorkflow 取消运行中的工作流, 未启动的步骤不再启动, 未就绪的常驻任务被停止
+func CancelWorkflow(workflowId string) *utils.CodeType {
+	var workflowDao = &dao.Workflow{}
+	wf, code := findWorkflow(workflowId)
+	if code.Code != 0 {
+		return code
+	}
+	ok, err := workflowDao.WithContext(context.Background()).UpdateStatus(wf.ID, workflow.StatusRunning, workflow.StatusCanceled, "canceled")
+	if err != nil {
+		level.Error(log.Logger).Log("CancelWorkflow Err", err.Error())
+		return utils.DBErr
+	}
+	if !ok {
+		return &utils.CodeType{}
+	}
+
+	steps, err := workflowDao.WithContext(context.Background()).ListSteps(workflowId)
+	if err != nil {
+		level.Error(log.Logger).Log("ListSteps Err", err.Error())
+		return utils.DBErr
+	}
+	for i := range steps {
+		step := &steps[i]
+		switch step.Status {
+		case workflow.StepPending:
+			setStepStatus(step, workflow.StepCanceled, "workflow canceled")
+		case workflow.StepRunning:
+			// doOnce 执行无法中途停止, 只标记取消
+			if spec := stepSpec(step); step.JobId != "" && (!spec.DoOnce || spec.BigOne != "") {
+				if code := StopSingleModeJob(step.JobId, true); code.Code != 0 {
+					level.Error(log.Logger).Log("msg", "Stop workflow step job err", "workflowId", workflowId, "step", step.Name, "err", code.Msg)
+				}
+			}
+			setStepStatus(step, workflow.StepCanceled, "workflow canceled")
+		}
+	}
+	return &utils.CodeType{}
+}
+
+// WorkflowList 工作流列表, 按 id 游标分页
+func WorkflowList(req params.WorkflowList) (interface{}, *utils.CodeType) {
+	var workflowDao = &dao.Workflow{}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	list, err := workflowDao.WithContext(context.Background()).List(req.Status, req.Cursor, limit+1)
+	if err != nil {
+		level.Error(log.Logger).Log("WorkflowList Err", err.Error())
+		return nil, utils.DBErr
+	}
+
+	hasMore := len(list) > limit
+	if hasMore {
+		list = list[:limit]
+	}
+	nextCursor := req.Cursor
+	if len(list) > 0 {
+		nextCursor = list[len(list)-1].ID
+	}
+	return map[string]interface{}{
+		"list":       list,
+		"nextCursor": nextCursor,
+		"hasMore":    hasMore,
+	}, &utils.CodeType{}
+}
+
+// WorkflowInfo 工作流及各步骤状态
+func WorkflowInfo(req params.WorkflowInfo) (interface{}, *utils.CodeType) {
+	var workflowDao = &dao.Workflow{}
+	wf, code := findWorkflow(req.WorkflowId)
+	if code.Code != 0 {
+		return nil, code
+	}
+	steps, err := workflowDao.WithContext(context.Background()).ListSteps(req.WorkflowId)
+	if err != nil {
+		level.Error(log.Logger).Log("ListSteps Err", err.Error())
+		return nil, utils.DBErr
+	}
+	return map[string]interface{}{
+		"workflow": wf,
+		"steps":    steps,
+	}, &utils.CodeType{}
+}
+
+func findWorkflow(workflowId string) (*entity.Workflow, *utils.CodeType) {
+	var workflowDao = &dao.Workflow{}
+	wf, err := workflowDao.WithContext(context.Background()).FindByWorkflowId(workflowId)
+	if err != nil {
+		level.Error(log.Logger).Log("FindByWorkflowId Err", err.Error())
+		return nil, utils.DBErr
+	}
+	if wf.ID <= 0 {
+		return nil, utils.DBRecorderNotExist
+	}
+	return wf, &utils.CodeType{}
+}
@@ -0,0 +1,114 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	"wsystemd/cmd/utils"
+)
+
+// ExecSpec 一次性任务的执行参数
+type ExecSpec struct {
+	Cmd     string
+	Args    []string
+	Outfile string
+	Errfile string
+	Timeout time.Duration
+	// 超时后先发送 Stop.Signal, 等待 Stop.Grace 后 SIGKILL
+	Stop StopOptions
+	// 保存的 stdout/stderr 最大字节数, 超出时只保留末尾, 完整输出写入 outfile/errfile
+	OutputLimit int
+}
+
+type ExecResult struct {
+	ExitCode  int
+	Signal    syscall.Signal
+	Stdout    string
+	Stderr    string
+	Truncated bool
+	TimedOut  bool
+	Duration  time.Duration
+}
+
+// RunOnce 执行命令直到退出或超时, 进程无法启动时返回错误, 非 0 退出码不视为错误
+func RunOnce(ctx context.Context, spec ExecSpec) (ExecResult, error) {
+	var result ExecResult
+	outFile, err := utils.GetFile(spec.Outfile)
+	if err != nil {
+		return result, err
+	}
+	defer outFile.Close()
+	errFile, err := utils.GetFile(spec.Errfile)
+	if err != nil {
+		return result, err
+	}
+	defer errFile.Close()
+
+	if spec.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, spec.Timeout)
+		defer cancel()
+	}
+	stdout, stderr := &tailBuffer{limit: spec.OutputLimit}, &tailBuffer{limit: spec.OutputLimit}
+	cmd := exec.CommandContext(ctx, spec.Cmd, spec.Args...)
+	cmd.Stdout = io.MultiWriter(outFile, stdout)
+	cmd.Stderr = io.MultiWriter(errFile, stderr)
+	stop := spec.Stop
+	if stop.Signal == 0 {
+		stop = NewStopOptions("", 0)
+	}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(stop.Signal)
+	}
+	// 发送停止信号后等待 grace 再 SIGKILL; 同时避免子进程派生的后台进程持有输出管道导致一直等待
+	cmd.WaitDelay = stop.Grace
+
+	start := time.Now()
+	if err = cmd.Start(); err != nil {
+		return result, err
+	}
+	err = cmd.Wait()
+	result.Duration = time.Since(start)
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+
+	result.ExitCode = -1
+	if state := cmd.ProcessState; state != nil {
+		result.ExitCode = state.ExitCode()
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			result.Signal = ws.Signal()
+		}
+	}
+	// 超时终止时 Wait 可能返回 ctx 的错误, 此时以 TimedOut 为准
+	var exitErr *exec.ExitError
+	if err != nil && !result.TimedOut && !errors.As(err, &exitErr) && !errors.Is(err, exec.ErrWaitDelay) {
+		return result, err
+	}
+	return result, nil
+}
+
+// tailBuffer 只保留最后 limit 字节, limit <= 0 时不限制
+type tailBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if b.limit > 0 && len(b.buf) > b.limit {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// String 截断可能切开多字节字符, 去掉不完整的部分
+func (b *tailBuffer) String() string {
+	return strings.ToValidUTF8(string(b.buf), "")
+}
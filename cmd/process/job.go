@@ -1 +1,122 @@
 package process
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"wsystemd/cmd/log"
+
+	"github.com/go-kit/kit/log/level"
+	procutil "github.com/shirou/gopsutil/process"
+)
+
+// ProcStat 进程实时状态
+type ProcStat struct {
+	Pid        int       `json:"pid"`
+	Alive      bool      `json:"alive"`
+	Zombie     bool      `json:"zombie"`
+	Status     string    `json:"status"`
+	CPUPercent float64   `json:"cpu_percent"`
+	RSS        uint64    `json:"rss"`
+	NumFds     int32     `json:"num_fds"`
+	StartTime  time.Time `json:"start_time"`
+	Uptime     int64     `json:"uptime"`
+}
+
+// Stat 获取进程实时状态, 进程不存在时 Alive 为 false
+func (m *ProcManager) Stat(pid int) *ProcStat {
+	stat := &ProcStat{Pid: pid}
+	if pid <= 0 {
+		return stat
+	}
+	proc, err := procutil.NewProcess(int32(pid))
+	if err != nil {
+		return stat
+	}
+
+	if s, err := proc.Status(); err == nil {
+		stat.Status = s
+		stat.Zombie = s == "Z"
+		stat.Alive = s != "Z" && s != "T"
+	}
+	if cpu, err := proc.CPUPercent(); err == nil {
+		stat.CPUPercent = cpu
+	}
+	if memInfo, err := proc.MemoryInfo(); err == nil && memInfo != nil {
+		stat.RSS = memInfo.RSS
+	}
+	if fds, err := proc.NumFDs(); err == nil {
+		stat.NumFds = fds
+	}
+	if ct, err := proc.CreateTime(); err == nil {
+		stat.StartTime = time.UnixMilli(ct)
+		stat.Uptime = int64(time.Since(stat.StartTime).Seconds())
+	}
+	return stat
+}
+
+// NewTaskToken 生成任务进程环境变量中的身份标识, 格式 hostName:随机串
+// 每次启动进程时重新生成并保存在 task 表, 心跳上报只接受该值
+func NewTaskToken(hostName string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hostName + ":" + hex.EncodeToString(b), nil
+}
+
+// legacyTaskToken 旧版本启动的进程使用的身份标识, 仅用于接管
+func legacyTaskToken(hostName, jobId string) string {
+	return hostName + ":" + jobId
+}
+
+// StartTime 获取进程启动时间(毫秒时间戳), 获取失败返回 0
+func (m *ProcManager) StartTime(pid int) int64 {
+	proc, err := procutil.NewProcess(int32(pid))
+	if err != nil {
+		return 0
+	}
+	ct, err := proc.CreateTime()
+	if err != nil {
+		return 0
+	}
+	return ct
+}
+
+// VerifyOwner 校验 pid 是否仍属于该任务, 防止 pid 被系统复用后误接管
+// startTime 为记录的进程启动时间, 为 0 时只校验 TASK_TOKEN; token 为空的旧记录按旧格式校验
+func (m *ProcManager) VerifyOwner(pid int, jobId, token string, startTime int64) bool {
+	if pid <= 0 || !m.IsAlive(pid) {
+		return false
+	}
+	if startTime > 0 {
+		ct := m.StartTime(pid)
+		// /proc 中的启动时间精度为 jiffies, 允许 1 秒误差
+		if ct == 0 || ct-startTime > 1000 || startTime-ct > 1000 {
+			return false
+		}
+	}
+
+	if token == "" {
+		hostName, err := GetHostName()
+		if err != nil {
+			return false
+		}
+		token = legacyTaskToken(hostName, jobId)
+	}
+	environ, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		level.Warn(log.Logger).Log("msg", "read process environ failed", "pid", pid, "err", err)
+		return false
+	}
+	expect := TaskTokenEnv + "=" + token
+	for _, env := range strings.Split(string(environ), "\x00") {
+		if env == expect {
+			return true
+		}
+	}
+	return false
+}
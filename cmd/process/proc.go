@@ -5,7 +5,6 @@ import (
 	"github.com/go-kit/kit/log/level"
 	procutil "github.com/shirou/gopsutil/process"
 	"os"
-	"os/exec"
 	"sync"
 	"syscall"
 	"time"
@@ -17,45 +16,122 @@ var (
 	PManager *ProcManager
 )
 
+const (
+	TaskTokenEnv = "TASK_TOKEN"
+
+	// 优雅退出等待时间, 超时后强制 kill
+	DefaultStopGrace = 3 * time.Second
+	// 发送 kill 后等待进程退出的时间
+	stopWaitTime = 5 * time.Second
+	// 接管进程不是子进程, 无法 wait, 只能轮询
+	adoptPollInterval = time.Second
+)
+
+// ExitEvent 进程退出事件
+type ExitEvent struct {
+	JobId    string
+	Pid      int
+	ExitCode int            // -1 表示无法获取(接管的进程)
+	Signal   syscall.Signal // 0 表示非信号终止
+	EndTime  time.Time
+	Stopped  bool   // 通过 StopProc 主动停止
+	Reason   string // 通过 Kill 终止的原因, 如健康检查失败
+}
+
+type proc struct {
+	pid      int
+	done     chan struct{}
+	stopping bool
+	reason   string
+	stop     StopOptions
+	deadline *time.Timer
+}
+
+// StopOptions 停止进程时先发送 Signal, 等待 Grace 后仍未退出则 SIGKILL, 同 systemd KillSignal/TimeoutStopSec
+type StopOptions struct {
+	Signal syscall.Signal
+	Grace  time.Duration
+}
+
+var stopSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// NewStopOptions 信号名为空或不支持时使用 SIGTERM, grace 单位秒, 0 使用默认值
+func NewStopOptions(signal string, grace int) StopOptions {
+	opts := StopOptions{Signal: syscall.SIGTERM, Grace: time.Duration(grace) * time.Second}
+	if sig, ok := stopSignals[signal]; ok {
+		opts.Signal = sig
+	}
+	if opts.Grace <= 0 {
+		opts.Grace = DefaultStopGrace
+	}
+	return opts
+}
+
 type ProcManager struct {
-	lock  sync.RWMutex
-	procs map[string]int
+	lock   sync.RWMutex
+	procs  map[string]*proc
+	onExit func(ExitEvent)
 }
 
 func NewProcManager() *ProcManager {
 	return &ProcManager{
-		procs: make(map[string]int),
+		procs: make(map[string]*proc),
 	}
 }
 
+// OnExit 注册进程退出回调, 每个进程退出时调用一次
+func (m *ProcManager) OnExit(fn func(ExitEvent)) {
+	m.lock.Lock()
+	m.onExit = fn
+	m.lock.Unlock()
+}
+
 func (p *ProcManager) JobExist(jobId string) (int, bool) {
 	p.lock.RLock()
-	pid, ok := p.procs[jobId]
-	p.lock.RUnlock()
-	return pid, ok
+	defer p.lock.RUnlock()
+	pr, ok := p.procs[jobId]
+	if !ok {
+		return 0, false
+	}
+	return pr.pid, true
 }
 
-func (m *ProcManager) StartProc(cmd string, args []string, outfile, errfile string, jobId string) (int, error) {
+// StartProc 启动进程, 返回 pid 及进程环境变量中的 TASK_TOKEN
+func (m *ProcManager) StartProc(cmd string, args []string, outfile, errfile string, jobId string) (int, string, error) {
 	fmt.Println("StartProc", cmd, args, outfile, errfile, jobId)
 	outFile, err := utils.GetFile(outfile)
 	if err != nil {
 		level.Error(log.Logger).Log("Err", fmt.Sprintf("utils.GetFile(outfile) Err: %s", err.Error()))
-		return 0, err
+		return 0, "", err
 	}
+	defer outFile.Close()
 	errFile, err := utils.GetFile(errfile)
 	if err != nil {
 		level.Error(log.Logger).Log("Err", fmt.Sprintf("utils.GetFile(errfile) Err: %s", err.Error()))
-		return 0, err
+		return 0, "", err
 	}
+	defer errFile.Close()
 	wd, _ := os.Getwd()
 	hostName, err := GetHostName()
 	if err != nil {
 		level.Error(log.Logger).Log("Err", fmt.Sprintf("GetHostName() Err: %s", err.Error()))
-		return 0, err
+		return 0, "", err
+	}
+	token, err := NewTaskToken(hostName)
+	if err != nil {
+		return 0, "", err
 	}
 	procAtr := &os.ProcAttr{
 		Dir: wd,
-		Env: []string{"TASK_TOKEN=" + hostName + ":" + jobId},
+		Env: []string{TaskTokenEnv + "=" + token},
 		Files: []*os.File{
 			os.Stdin,
 			outFile,
@@ -64,64 +140,193 @@ func (m *ProcManager) StartProc(cmd string, args []string, outfile, errfile stri
 	}
 	process, err := os.StartProcess(cmd, append([]string{cmd}, args...), procAtr)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
-	m.procs[jobId] = process.Pid
-	return process.Pid, nil
+
+	pr := &proc{pid: process.Pid, done: make(chan struct{}), stop: NewStopOptions("", 0)}
+	m.lock.Lock()
+	m.procs[jobId] = pr
+	m.lock.Unlock()
+
+	go m.supervise(jobId, pr, process)
+	return process.Pid, token, nil
 }
 
-func (m *ProcManager) StopProc(jobId string, pid int, force bool) (int, error) {
-	var (
-		err  error
-		done = make(chan error, 1)
-	)
-	m.stopProc(pid, force)
-	go func() {
-		// 造成僵尸进程的原因
-		// 	wait, err := procInfo.Wait() if err != nil { level.Error(log.Logger).Log("Err", fmt.Sprintf("Failed to wait for process %d Err: %s", pid, err.Error())) continue } if wait.ExitCode() == 0 { break } 和 _, err = syscall.Wait4(pid, nil, 0, nil) 功能分别是什么 ,冲突么
-		_, err = syscall.Wait4(pid, nil, 0, nil)
-		done <- err
-	}()
-	select {
-	case err = <-done:
-		if err != nil && err.Error() != "no child processes" {
-			level.Error(log.Logger).Log("Err", fmt.Sprintf("syscall.Wait4(to kill son process) Err: %s", err.Error()))
-			return -1, nil
+// Adopt 接管守护进程重启前启动的进程
+func (m *ProcManager) Adopt(jobId string, pid int) {
+	pr := &proc{pid: pid, done: make(chan struct{}), stop: NewStopOptions("", 0)}
+	m.lock.Lock()
+	m.procs[jobId] = pr
+	m.lock.Unlock()
+
+	go m.superviseAdopted(jobId, pr)
+}
+
+// supervise 等待子进程退出并回收, 避免产生僵尸进程
+func (m *ProcManager) supervise(jobId string, pr *proc, process *os.Process) {
+	ev := ExitEvent{JobId: jobId, Pid: pr.pid, ExitCode: -1}
+	state, err := process.Wait()
+	if err != nil {
+		level.Error(log.Logger).Log("Err", fmt.Sprintf("Wait process %d Err: %s", pr.pid, err.Error()))
+	} else {
+		ev.ExitCode = state.ExitCode()
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			ev.Signal = ws.Signal()
 		}
-		level.Info(log.Logger).Log("msg", fmt.Sprintf("All processes %d are killed", pid))
-	case <-time.After(time.Second * 5):
-		level.Error(log.Logger).Log("Err", fmt.Sprintf("process %d is not killed after 5 seconds", pid))
-		return -2, nil
 	}
+	m.finish(jobId, pr, ev)
+}
 
-	return 0, nil
+// superviseAdopted 接管的进程已被 init 收养, 只能轮询其是否存活
+func (m *ProcManager) superviseAdopted(jobId string, pr *proc) {
+	ticker := time.NewTicker(adoptPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !pidExists(pr.pid) {
+			break
+		}
+	}
+	m.finish(jobId, pr, ExitEvent{JobId: jobId, Pid: pr.pid, ExitCode: -1})
+}
+
+func (m *ProcManager) finish(jobId string, pr *proc, ev ExitEvent) {
+	ev.EndTime = time.Now()
+	m.lock.Lock()
+	if cur, ok := m.procs[jobId]; ok && cur == pr {
+		delete(m.procs, jobId)
+	}
+	ev.Stopped = pr.stopping
+	ev.Reason = pr.reason
+	if pr.deadline != nil {
+		pr.deadline.Stop()
+	}
+	onExit := m.onExit
+	m.lock.Unlock()
+	close(pr.done)
+
+	level.Info(log.Logger).Log("msg", "Process exited", "jobId", jobId, "pid", ev.Pid,
+		"exitCode", ev.ExitCode, "signal", ev.Signal, "stopped", ev.Stopped)
+	if onExit != nil {
+		onExit(ev)
+	}
+}
+
+// SetLimits 设置任务的停止选项, deadline 不为零值时进程运行到 deadline 后按停止选项终止, 退出原因为 timeout
+func (m *ProcManager) SetLimits(jobId string, stop StopOptions, deadline time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	pr, ok := m.procs[jobId]
+	if !ok {
+		return
+	}
+	pr.stop = stop
+	if pr.deadline != nil {
+		pr.deadline.Stop()
+		pr.deadline = nil
+	}
+	if deadline.IsZero() {
+		return
+	}
+	pr.deadline = time.AfterFunc(time.Until(deadline), func() {
+		m.lock.Lock()
+		if cur, ok := m.procs[jobId]; !ok || cur != pr || pr.stopping {
+			m.lock.Unlock()
+			return
+		}
+		pr.reason = OutcomeTimeout
+		m.lock.Unlock()
+
+		level.Warn(log.Logger).Log("msg", "Process exceeded max runtime", "jobId", jobId, "pid", pr.pid, "signal", stop.Signal)
+		m.terminate(pr, stop)
+	})
 }
 
-func (p *ProcManager) stopProc(pid int, force bool) error {
-	forceStop := func() error {
-		cmd := exec.Command("kill", "-9", fmt.Sprintf("%d", pid))
-		err := cmd.Run()
-		time.Sleep(5 * time.Millisecond)
-		if err != nil {
-			level.Error(log.Logger).Log("Err", fmt.Sprintf("Failed to kill process %d Err: %s", pid, err.Error()))
-			return err
+// terminate 发送停止信号, 等待 grace 后仍未退出则 SIGKILL
+func (m *ProcManager) terminate(pr *proc, stop StopOptions) {
+	if stop.Signal != syscall.SIGKILL && m.signal(pr.pid, stop.Signal) == nil {
+		select {
+		case <-pr.done:
+			return
+		case <-time.After(stop.Grace):
 		}
-		return nil
 	}
-	if force {
-		return forceStop()
+	_ = m.signal(pr.pid, syscall.SIGKILL)
+}
+
+func (m *ProcManager) StopProc(jobId string, pid int, force bool) (int, error) {
+	stop := NewStopOptions("", 0)
+	m.lock.Lock()
+	pr, ok := m.procs[jobId]
+	if ok && pr.pid == pid {
+		pr.stopping = true
+		stop = pr.stop
+	} else {
+		ok = false
+	}
+	m.lock.Unlock()
+
+	// 不在管理中的进程(如重启前的一次性任务), 只能轮询是否退出
+	exited := func(timeout time.Duration) bool {
+		if ok {
+			select {
+			case <-pr.done:
+				return true
+			case <-time.After(timeout):
+				return false
+			}
+		}
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			if !pidExists(pid) {
+				return true
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return !pidExists(pid)
 	}
-	i := 0
-	for ; i < 3; i++ {
-		cmd := exec.Command("kill", "-15", fmt.Sprintf("%d", pid))
-		err := cmd.Run()
-		if err != nil {
-			level.Error(log.Logger).Log("Err", fmt.Sprintf("GracefullyStop process %d Err: %s", pid, err.Error()))
+
+	if !force && stop.Signal != syscall.SIGKILL {
+		if err := m.signal(pid, stop.Signal); err == nil && exited(stop.Grace) {
+			level.Info(log.Logger).Log("msg", fmt.Sprintf("Process %d stopped gracefully", pid))
+			return 0, nil
 		}
-		time.Sleep(5 * time.Millisecond)
 	}
+	if err := m.signal(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return -1, nil
+	}
+	if !exited(stopWaitTime) {
+		level.Error(log.Logger).Log("Err", fmt.Sprintf("process %d is not killed after %s", pid, stopWaitTime))
+		return -2, nil
+	}
+	level.Info(log.Logger).Log("msg", fmt.Sprintf("All processes %d are killed", pid))
+	return 0, nil
+}
+
+// Kill 因故障终止进程(非主动停止), 退出事件会带上 reason 并按重启策略处理
+func (m *ProcManager) Kill(jobId, reason string) error {
+	m.lock.Lock()
+	pr, ok := m.procs[jobId]
+	if ok {
+		pr.reason = reason
+	}
+	m.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("job %s is not running", jobId)
+	}
+	return m.signal(pr.pid, syscall.SIGKILL)
+}
+
+func (m *ProcManager) signal(pid int, sig syscall.Signal) error {
+	err := syscall.Kill(pid, sig)
+	if err != nil && err != syscall.ESRCH {
+		level.Error(log.Logger).Log("Err", fmt.Sprintf("Failed to send %s to process %d Err: %s", sig, pid, err.Error()))
+	}
+	return err
+}
 
-	return forceStop()
+func pidExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
 }
 
 func (m *ProcManager) IsAlive(pid int) bool {
@@ -139,12 +344,24 @@ func (m *ProcManager) IsAlive(pid int) bool {
 	return s != "Z" && s != "T"
 }
 
+// JobIds 监控中的任务
+func (m *ProcManager) JobIds() []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	ids := make([]string, 0, len(m.procs))
+	for jobId := range m.procs {
+		ids = append(ids, jobId)
+	}
+	return ids
+}
+
 func (m *ProcManager) DelProc(jobId string) int {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	proc, ok := m.procs[jobId]
-	if ok {
-		delete(m.procs, jobId)
+	pr, ok := m.procs[jobId]
+	if !ok {
+		return 0
 	}
-	return proc
+	delete(m.procs, jobId)
+	return pr.pid
 }
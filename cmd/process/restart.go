@@ -0,0 +1,195 @@
+package process
+
+import (
+	"syscall"
+	"time"
+)
+
+// 重启策略, 与 systemd Restart= 含义一致, unless-stopped 参考 docker
+const (
+	RestartNo            = "no"
+	RestartAlways        = "always"
+	RestartOnFailure     = "on-failure"
+	RestartOnAbnormal    = "on-abnormal"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+const (
+	DefaultRestartSec         = time.Second
+	DefaultRestartMaxSec      = 60 * time.Second
+	DefaultStartLimitBurst    = 5
+	DefaultStartLimitInterval = 300 * time.Second
+)
+
+// 退出结果, 记录在 task.outcome
+const (
+	OutcomeSuccess     = "success"
+	OutcomeFailure     = "failure"
+	OutcomeSignal      = "signal"
+	OutcomeStopped     = "stopped"
+	OutcomeLost        = "lost"
+	OutcomeStartFailed = "start-failed"
+	OutcomeUnhealthy   = "unhealthy"
+	// 超过 timeout/maxRuntime 被终止
+	OutcomeTimeout = "timeout"
+)
+
+type RestartPolicy struct {
+	Policy             string
+	RestartSec         time.Duration
+	RestartMaxSec      time.Duration
+	StartLimitBurst    int
+	StartLimitInterval time.Duration
+
+	// 视为失败的退出码, 为空时非 0 即失败
+	FailCodes []int
+	// 额外视为正常的退出码, 同 systemd SuccessExitStatus
+	SuccessCodes []int
+	// 不触发重启的退出码, 同 systemd RestartPreventExitStatus
+	PreventRestartCodes []int
+}
+
+// NewRestartPolicy 未设置的字段使用默认值, 秒为单位
+func NewRestartPolicy(policy string, restartSec, restartMaxSec, burst, interval int) RestartPolicy {
+	p := RestartPolicy{
+		Policy:             policy,
+		RestartSec:         time.Duration(restartSec) * time.Second,
+		RestartMaxSec:      time.Duration(restartMaxSec) * time.Second,
+		StartLimitBurst:    burst,
+		StartLimitInterval: time.Duration(interval) * time.Second,
+	}
+	// 兼容旧任务: 未设置时常驻任务总是重启
+	if p.Policy == "" {
+		p.Policy = RestartAlways
+	}
+	if p.RestartSec <= 0 {
+		p.RestartSec = DefaultRestartSec
+	}
+	if p.RestartMaxSec <= 0 {
+		p.RestartMaxSec = DefaultRestartMaxSec
+	}
+	if p.RestartMaxSec < p.RestartSec {
+		p.RestartMaxSec = p.RestartSec
+	}
+	if p.StartLimitBurst <= 0 {
+		p.StartLimitBurst = DefaultStartLimitBurst
+	}
+	if p.StartLimitInterval <= 0 {
+		p.StartLimitInterval = DefaultStartLimitInterval
+	}
+	return p
+}
+
+// ShouldRestart 根据退出事件判断是否需要重启, 主动停止的进程不重启
+func (p RestartPolicy) ShouldRestart(ev ExitEvent) bool {
+	if ev.Stopped {
+		return false
+	}
+	if ev.Signal == 0 && ev.ExitCode >= 0 && containsCode(p.PreventRestartCodes, ev.ExitCode) {
+		return false
+	}
+	switch p.Policy {
+	case RestartAlways, RestartUnlessStopped:
+		return true
+	case RestartOnFailure:
+		return !p.Clean(ev)
+	case RestartOnAbnormal:
+		return ev.Abnormal()
+	default:
+		return false
+	}
+}
+
+// Clean 按任务声明的退出码判断是否正常退出
+func (p RestartPolicy) Clean(ev ExitEvent) bool {
+	if ev.Reason != "" || ev.Signal != 0 || ev.ExitCode < 0 {
+		return ev.Clean()
+	}
+	if containsCode(p.SuccessCodes, ev.ExitCode) {
+		return true
+	}
+	if len(p.FailCodes) > 0 {
+		return !containsCode(p.FailCodes, ev.ExitCode)
+	}
+	return ev.ExitCode == 0
+}
+
+// Outcome 退出结果分类
+func (p RestartPolicy) Outcome(ev ExitEvent) string {
+	switch {
+	case ev.Stopped:
+		return OutcomeStopped
+	case ev.Reason != "":
+		return ev.Reason
+	case p.Clean(ev):
+		return OutcomeSuccess
+	case ev.Signal != 0:
+		return OutcomeSignal
+	case ev.ExitCode < 0:
+		return OutcomeLost
+	default:
+		return OutcomeFailure
+	}
+}
+
+// Next 计算下一次重启的等待时间, history 为窗口内的历史重启时间
+// 窗口内重启次数达到 StartLimitBurst 时返回 ok=false
+func (p RestartPolicy) Next(history []time.Time, now time.Time) (delay time.Duration, recent []time.Time, ok bool) {
+	for _, t := range history {
+		if now.Sub(t) < p.StartLimitInterval {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= p.StartLimitBurst {
+		return 0, recent, false
+	}
+
+	delay = p.RestartSec
+	for i := 0; i < len(recent); i++ {
+		delay *= 2
+		if delay >= p.RestartMaxSec {
+			delay = p.RestartMaxSec
+			break
+		}
+	}
+	return delay, append(recent, now), true
+}
+
+// Clean 正常退出: 退出码为 0, 或被 SIGHUP/SIGINT/SIGTERM/SIGPIPE 终止
+func (ev ExitEvent) Clean() bool {
+	if ev.Reason != "" {
+		return false
+	}
+	if ev.Signal != 0 {
+		return cleanSignal(ev.Signal)
+	}
+	return ev.ExitCode == 0
+}
+
+// Abnormal 异常退出: 因故障被终止, 被非正常信号终止, 或退出状态未知
+func (ev ExitEvent) Abnormal() bool {
+	if ev.Reason != "" {
+		return true
+	}
+	if ev.Signal != 0 {
+		return !cleanSignal(ev.Signal)
+	}
+	return ev.ExitCode < 0
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanSignal(sig syscall.Signal) bool {
+	switch sig {
+	case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE:
+		return true
+	}
+	return false
+}
@@ -9,9 +9,12 @@ import (
 	"syscall"
 	"time"
 	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/health"
 	srv "wsystemd/cmd/http"
 	"wsystemd/cmd/http/consts"
 	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/middlewares"
+	"wsystemd/cmd/http/service"
 	"wsystemd/cmd/log"
 	"wsystemd/cmd/process"
 	"wsystemd/cmd/task"
@@ -51,13 +54,35 @@ func Run() int {
 		return 1
 	}
 
+	process.PManager.OnExit(service.HandleJobExit)
+	health.HEngine = health.NewEngine()
+	health.HEngine.OnChange(service.HandleHealthChange)
+	if err := service.RecoverJobs(); err != nil {
+		level.Error(log.Logger).Log("msg", "Recover jobs fail", "err", err)
+	}
+	if err := service.RecoverExecutions(); err != nil {
+		level.Error(log.Logger).Log("msg", "Recover executions fail", "err", err)
+	}
+
+	var manager *cluster.WorkerManager
 	if val, ok := core.CoreConfig["singlemode"]; ok && !val.(bool) {
 		wId := core.CoreConfig["workerid"].(string)
-		cAddr := cluster.GetEtcdAddr()
-		if wId == "" || cAddr == "" {
-			panic("workerId/etcdAddr is empty")
+		if wId == "" {
+			panic("workerId is empty")
 		}
-		manager, err := cluster.NewWorkerManager([]string{cAddr}, wId)
+		etcdConf, err := cluster.GetEtcdConfig()
+		if err != nil {
+			panic(err)
+		}
+		// 转发请求跳过调度和权限校验, 节点之间必须通过签名或双向证书认证
+		if tlsConf := core.GetTLSConfig(); cluster.GetRpcConfig().Secret == "" && (!tlsConf.Enabled() || tlsConf.CaFile == "") {
+			level.Error(log.Logger).Log("msg", "rpc.secret or tls certFile/keyFile/caFile is required in cluster mode")
+			return 1
+		}
+		if !middlewares.GetAuthConfig().Enabled {
+			level.Warn(log.Logger).Log("msg", "auth is disabled, requests from any client are treated as admin")
+		}
+		manager, err = cluster.NewWorkerManager(etcdConf, wId)
 		if err != nil {
 			level.Error(log.Logger).Log("msg", "Failed to create worker manager", "err", err)
 			return 1
@@ -67,11 +92,36 @@ func Run() int {
 			level.Error(log.Logger).Log("msg", "Failed to register worker", "err", err)
 			return 1
 		}
+		// 失联期间被故障转移的任务由新节点运行, 本节点停止自己的副本
+		manager.OnReRegister(service.ReleaseMovedTasks)
+		// 上次退出时正在迁移的节点继续迁移
+		if manager.State() == cluster.WorkerDraining {
+			go service.DrainLocal()
+		}
+		cluster.RegisterLeaderTask("failover", service.FailoverLoop)
+		// 定时器只由 leader 触发
+		cluster.RegisterLeaderTask("timer", service.TimerLoop)
+		cluster.RegisterLeaderTask("workflow", service.WorkflowLoop)
+		cluster.RegisterLeaderTask("pending", service.PendingLoop)
+		if cluster.GetRebalanceConfig().Enabled {
+			cluster.RegisterLeaderTask("rebalance", service.RebalanceLoop)
+		}
+		go manager.RunElection(shutdownCtx)
+	} else {
+		go service.TimerLoop(shutdownCtx)
+		go service.WorkflowLoop(shutdownCtx)
+		go service.PendingLoop(shutdownCtx)
 	}
 
 	go func() {
 		level.Info(log.Logger).Log("msg", "Start HTTP Server Success!!! ", "port", *serverPort)
-		if err := http.ListenAndServe(":"+*serverPort, srv); err != nil {
+		var err error
+		if tlsConf := core.GetTLSConfig(); tlsConf.Enabled() {
+			err = listenAndServeTLS(":"+*serverPort, srv, tlsConf)
+		} else {
+			err = http.ListenAndServe(":"+*serverPort, srv)
+		}
+		if err != nil {
 			level.Error(log.Logger).Log("msg", "Error starting HTTP server", "err", err)
 			time.Sleep(time.Second * 2)
 			shutdownCancel()
@@ -90,6 +140,9 @@ func Run() int {
 		defer cancel()
 
 		shutdownCancel()
+		if manager != nil {
+			manager.Deregister()
+		}
 		CleanFunc(cleanFun)
 
 		select {
@@ -122,3 +175,13 @@ func CleanFunc(cleanFun []func()) {
 		}()
 	}
 }
+
+// listenAndServeTLS 配置了 caFile 时校验客户端证书, 用于证书认证
+func listenAndServeTLS(addr string, handler http.Handler, conf *core.TLSConfig) error {
+	tlsConfig, err := conf.ServerConfig()
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+	return server.ListenAndServeTLS("", "")
+}
@@ -26,7 +26,7 @@ func CheckClientTask(ctx context.Context) {
 			err := service.CheckClientAlive()
 			if err != nil {
 				fmt.Println("")
-				level.Error(log.Logger).Log("Err", fmt.Sprintf("Schedule CheckClientAlive Err: %s"))
+				level.Error(log.Logger).Log("Err", fmt.Sprintf("Schedule CheckClientAlive Err: %s", err.Error()))
 				fmt.Println("")
 				time.Sleep(time.Second * 10)
 			}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/middlewares"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/utils"
+
+	"github.com/gin-gonic/gin"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthRoles(t *testing.T) {
+	log.Logger = kitlog.NewNopLogger()
+	jwtSecret := "jwt-secret"
+	core.CoreConfig = map[string]interface{}{
+		"auth": map[string]interface{}{
+			"enabled": true,
+			"tokens": []interface{}{
+				map[string]interface{}{"name": "dashboard", "token": "viewer-token", "role": "viewer"},
+			},
+			"jwt": map[string]interface{}{"alg": "HS256", "secret": jwtSecret},
+		},
+	}
+	if err := middlewares.InitAuth(); err != nil {
+		t.Fatalf("init auth: %v", err)
+	}
+
+	// 示例配置中的占位 token 不允许使用
+	placeholder := &middlewares.AuthConfig{Tokens: []middlewares.TokenConfig{{Name: "dashboard", Token: "change-me", Role: "viewer"}}}
+	if _, err := middlewares.NewAuthenticators(placeholder); err == nil {
+		t.Fatal("placeholder token: expected error")
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middlewares.Authenticate())
+	engine.GET("/list", middlewares.RequireRole(middlewares.RoleViewer), utils.Success)
+	engine.POST("/submit", middlewares.RequireRole(middlewares.RoleOperator), utils.Success)
+
+	operatorJwt, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "ci", "role": "operator", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(jwtSecret))
+	forgedJwt, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "ci", "role": "admin", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("other"))
+
+	cases := []struct {
+		method, path, token string
+		code                int
+	}{
+		{"GET", "/list", "", utils.Unauthorized.Code},
+		{"GET", "/list", "viewer-token", utils.SUCCESS.Code},
+		{"POST", "/submit", "viewer-token", utils.Forbidden.Code},
+		{"POST", "/submit", operatorJwt, utils.SUCCESS.Code},
+		{"POST", "/submit", forgedJwt, utils.Unauthorized.Code},
+		{"GET", "/list", "wrong-token", utils.Unauthorized.Code},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: http status %d", c.method, c.path, w.Code)
+		}
+		var rep utils.RepType
+		if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil || rep.Code != c.code {
+			t.Fatalf("%s %s token=%.10s: got code %d, want %d", c.method, c.path, c.token, rep.Code, c.code)
+		}
+	}
+}
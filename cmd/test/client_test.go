@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"wsystemd/cmd/cluster"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/utils"
+)
+
+func TestWorkerClient(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		switch {
+		case r.Header.Get(cluster.RpcVersionHeader) != cluster.RpcVersion:
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == http.MethodPut && n == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.Method == http.MethodPut:
+			_, _ = w.Write([]byte(`{"code":200,"message":"ok","data":{}}`))
+		case r.URL.Query().Get("token") != "":
+			_, _ = w.Write([]byte(`{"code":200,"message":"ok","data":{}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	client := cluster.NewWorkerClient(&cluster.Worker{Hostname: "node-a", IP: host, Port: port})
+
+	// stop 幂等, 5xx 后重试成功
+	if err := client.Stop(context.Background(), "job-1"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("stop: got %d calls, want 2", calls)
+	}
+
+	if err := client.Report(context.Background(), params.JobReporter{Token: "node-a:1", Pid: "1"}); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+
+	// submit 非幂等, 失败不重试
+	calls = 0
+	if _, err := client.Submit(context.Background(), params.JobCfg{}); err == nil {
+		t.Fatal("submit: want error")
+	}
+	if calls != 1 {
+		t.Fatalf("submit: got %d calls, want 1", calls)
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	remote := &cluster.RemoteError{Code: &utils.CodeType{Code: utils.StopNotExist.Code, Msg: utils.StopNotExist.Msg}}
+	if code := cluster.CodeOf(remote); code.Code != utils.StopNotExist.Code {
+		t.Fatalf("remote: got %d, want %d", code.Code, utils.StopNotExist.Code)
+	}
+	if code := cluster.CodeOf(cluster.ErrWorkerNotFound); code != utils.ServerNotExist {
+		t.Fatalf("not found: got %d", code.Code)
+	}
+	if code := cluster.CodeOf(nil); code.Code != 0 {
+		t.Fatalf("nil: got %d", code.Code)
+	}
+}
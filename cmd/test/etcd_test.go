@@ -0,0 +1,43 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+	"wsystemd/cmd/cluster"
+)
+
+func TestParseEtcdConfig(t *testing.T) {
+	conf, err := cluster.ParseEtcdConfig("127.0.0.1")
+	if err != nil || !reflect.DeepEqual(conf.Endpoints, []string{"127.0.0.1:2379"}) {
+		t.Fatalf("string: got %+v %v", conf, err)
+	}
+
+	conf, err = cluster.ParseEtcdConfig([]interface{}{"10.0.0.1", "10.0.0.2:2389", "https://10.0.0.3"})
+	want := []string{"10.0.0.1:2379", "10.0.0.2:2389", "https://10.0.0.3:2379"}
+	if err != nil || !reflect.DeepEqual(conf.Endpoints, want) {
+		t.Fatalf("list: got %+v %v", conf, err)
+	}
+
+	conf, err = cluster.ParseEtcdConfig(map[string]interface{}{
+		"endpoints":   []interface{}{"10.0.0.1"},
+		"username":    "root",
+		"prefix":      "wsystemd/prod/",
+		"dialtimeout": 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Username != "root" || conf.Prefix != "/wsystemd/prod" || conf.DialTimeout != 3 || conf.RequestTimeout <= 0 {
+		t.Fatalf("map: got %+v", conf)
+	}
+
+	if _, err = cluster.ParseEtcdConfig(""); err == nil {
+		t.Fatal("empty endpoints should fail")
+	}
+	if _, err = cluster.ParseEtcdConfig(map[string]interface{}{
+		"endpoints": []interface{}{"10.0.0.1"},
+		"certfile":  "client.crt",
+	}); err == nil {
+		t.Fatal("certFile without keyFile should fail")
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"wsystemd/cmd/process"
+)
+
+func TestRunOnce(t *testing.T) {
+	dir := t.TempDir()
+	spec := process.ExecSpec{
+		Cmd:         "/bin/sh",
+		Args:        []string{"-c", "echo 0123456789; echo err >&2; exit 3"},
+		Outfile:     filepath.Join(dir, "out.log"),
+		Errfile:     filepath.Join(dir, "err.log"),
+		OutputLimit: 5,
+	}
+	result, err := process.RunOnce(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只保留输出末尾
+	if result.ExitCode != 3 || result.Stdout != "6789\n" || result.Stderr != "err\n" || !result.Truncated {
+		t.Fatalf("got %+v", result)
+	}
+
+	// 超时后发送停止信号, 进程忽略信号时 grace 后 SIGKILL
+	spec.Args = []string{"-c", "trap '' TERM; sleep 5"}
+	spec.Timeout = 200 * time.Millisecond
+	spec.Stop = process.StopOptions{Signal: syscall.SIGTERM, Grace: 200 * time.Millisecond}
+	start := time.Now()
+	if result, err = process.RunOnce(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut || time.Since(start) > 3*time.Second {
+		t.Fatalf("timeout: got %+v after %s", result, time.Since(start))
+	}
+}
+
+func TestStopOptions(t *testing.T) {
+	opts := process.NewStopOptions("", 0)
+	if opts.Signal != syscall.SIGTERM || opts.Grace != process.DefaultStopGrace {
+		t.Fatalf("default: got %+v", opts)
+	}
+	if opts = process.NewStopOptions("SIGINT", 10); opts.Signal != syscall.SIGINT || opts.Grace != 10*time.Second {
+		t.Fatalf("got %+v", opts)
+	}
+
+	// 超时终止的退出按 on-failure 重启, outcome 为 timeout
+	ev := process.ExitEvent{ExitCode: -1, Signal: syscall.SIGTERM, Reason: process.OutcomeTimeout}
+	policy := process.NewRestartPolicy(process.RestartOnFailure, 0, 0, 0, 0)
+	if policy.Outcome(ev) != process.OutcomeTimeout || !policy.ShouldRestart(ev) {
+		t.Fatalf("timeout outcome %s restart %v", policy.Outcome(ev), policy.ShouldRestart(ev))
+	}
+}
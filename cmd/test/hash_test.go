@@ -0,0 +1,44 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"wsystemd/cmd/cluster"
+)
+
+func TestHashRingStable(t *testing.T) {
+	var (
+		nodes   = []string{"node-a", "node-b", "node-c"}
+		ring    = cluster.NewHashRing(0, nodes...)
+		reorder = cluster.NewHashRing(0, "node-c", "node-a", "node-b")
+		before  = make(map[string]string)
+		total   = 3000
+	)
+	if cluster.NewHashRing(0).Get("any") != "" {
+		t.Fatal("empty ring should return empty node")
+	}
+	for i := 0; i < total; i++ {
+		key := fmt.Sprintf("job-%d", i)
+		before[key] = ring.Get(key)
+		if reorder.Get(key) != before[key] {
+			t.Fatalf("key %s: placement depends on node order", key)
+		}
+	}
+
+	// 新增节点后, 只有迁移到新节点的 key 会变化
+	grown := cluster.NewHashRing(0, append(nodes, "node-d")...)
+	moved := 0
+	for key, node := range before {
+		after := grown.Get(key)
+		if after == node {
+			continue
+		}
+		if after != "node-d" {
+			t.Fatalf("key %s moved from %s to %s", key, node, after)
+		}
+		moved++
+	}
+	if moved == 0 || moved > total/2 {
+		t.Fatalf("unexpected moved keys %d of %d", moved, total)
+	}
+}
@@ -0,0 +1,32 @@
+package test
+
+import (
+	"testing"
+	"wsystemd/cmd/http/params"
+	"wsystemd/cmd/utils"
+)
+
+func TestJobCfgNormalize(t *testing.T) {
+	req := params.JobCfg{
+		Run:        params.JobRun{Cmd: "/bin/true", Outfile: "/dev/null", Errfile: "/dev/null"},
+		Restart:    "On_Failure",
+		LoadMethod: "RR",
+		Checks: []params.JobCheck{
+			{Api: "http://127.0.0.1:8080/health"},
+			{Api: "127.0.0.1:8080"},
+			{Cmd: "/bin/true"},
+		},
+	}
+	req.Normalize()
+	if req.Restart != "on-failure" || req.LoadMethod != "round_robin" {
+		t.Fatalf("normalize: got restart %q loadMethod %q", req.Restart, req.LoadMethod)
+	}
+	for i, want := range []string{"http", "tcp", "cmd"} {
+		if req.Checks[i].Type != want {
+			t.Fatalf("check %d: got %q, want %q", i, req.Checks[i].Type, want)
+		}
+	}
+	if err := utils.NewValidator().Validate.Struct(req); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"testing"
+	"wsystemd/cmd/cluster"
+)
+
+func TestPlanRebalance(t *testing.T) {
+	var (
+		conf = &cluster.RebalanceConfig{Metric: cluster.RebalanceTaskCount, Threshold: 2, MaxMoves: 10}
+		cord = worker("node-c", 0, 0, 0, 0)
+	)
+	cord.Status = cluster.WorkerCordoned
+	workers := []cluster.Worker{worker("node-a", 0, 0, 0, 10), worker("node-b", 0, 0, 0, 2), cord}
+
+	// 只在 active 节点之间迁移, 差值不超过阈值后停止
+	moves := cluster.PlanRebalance(workers, conf)
+	if len(moves) != 3 {
+		t.Fatalf("got %d moves, want 3", len(moves))
+	}
+	for _, move := range moves {
+		if move.From != "node-a" || move.To != "node-b" {
+			t.Fatalf("got move %s -> %s, want node-a -> node-b", move.From, move.To)
+		}
+	}
+
+	conf.MaxMoves = 1
+	if moves = cluster.PlanRebalance(workers, conf); len(moves) != 1 {
+		t.Fatalf("rate limited: got %d moves, want 1", len(moves))
+	}
+
+	conf.Threshold = 8
+	if moves = cluster.PlanRebalance(workers, conf); len(moves) != 0 {
+		t.Fatalf("balanced: got %d moves, want 0", len(moves))
+	}
+
+	// cpu 按单个任务的平均占用估算, 迁移后不会比原来更不均衡
+	conf = &cluster.RebalanceConfig{Metric: cluster.RebalanceCpu, Threshold: 10, MaxMoves: 10}
+	workers = []cluster.Worker{worker("node-a", 80, 0, 0, 1), worker("node-b", 10, 0, 0, 1)}
+	if moves = cluster.PlanRebalance(workers, conf); len(moves) != 0 {
+		t.Fatalf("cpu: got %d moves, want 0", len(moves))
+	}
+	workers[0].Resources.TaskCount = 4
+	if moves = cluster.PlanRebalance(workers, conf); len(moves) != 2 {
+		t.Fatalf("cpu: got %d moves, want 2", len(moves))
+	}
+}
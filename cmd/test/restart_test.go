@@ -0,0 +1,99 @@
+package test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+	"wsystemd/cmd/process"
+)
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	var (
+		clean   = process.ExitEvent{ExitCode: 0}
+		failed  = process.ExitEvent{ExitCode: 1}
+		killed  = process.ExitEvent{ExitCode: -1, Signal: syscall.SIGKILL}
+		term    = process.ExitEvent{ExitCode: -1, Signal: syscall.SIGTERM}
+		stopped = process.ExitEvent{ExitCode: -1, Signal: syscall.SIGKILL, Stopped: true}
+		cases   = []struct {
+			policy string
+			ev     process.ExitEvent
+			expect bool
+		}{
+			{process.RestartNo, failed, false},
+			{process.RestartAlways, clean, true},
+			{process.RestartAlways, stopped, false},
+			{process.RestartUnlessStopped, clean, true},
+			{process.RestartOnFailure, clean, false},
+			{process.RestartOnFailure, failed, true},
+			{process.RestartOnFailure, term, false},
+			{process.RestartOnFailure, killed, true},
+			{process.RestartOnAbnormal, failed, false},
+			{process.RestartOnAbnormal, killed, true},
+			{"", clean, true},
+		}
+	)
+	for _, c := range cases {
+		p := process.NewRestartPolicy(c.policy, 0, 0, 0, 0)
+		if got := p.ShouldRestart(c.ev); got != c.expect {
+			t.Errorf("policy %q exit %+v: expect %v, got %v", c.policy, c.ev, c.expect, got)
+		}
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	var (
+		p       = process.NewRestartPolicy(process.RestartAlways, 1, 5, 4, 60)
+		now     = time.Now()
+		history []time.Time
+		expect  = []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	)
+	for i, want := range expect {
+		delay, h, ok := p.Next(history, now)
+		if !ok || delay != want {
+			t.Fatalf("restart %d: expect %s, got %s ok=%v", i, want, delay, ok)
+		}
+		history = h
+	}
+	if _, _, ok := p.Next(history, now); ok {
+		t.Fatal("expect start limit hit")
+	}
+	// 窗口过后重新计数
+	if delay, _, ok := p.Next(history, now.Add(61*time.Second)); !ok || delay != time.Second {
+		t.Fatalf("expect reset after interval, got %s ok=%v", delay, ok)
+	}
+}
+
+func TestRestartPolicyExitCodes(t *testing.T) {
+	p := process.NewRestartPolicy(process.RestartOnFailure, 0, 0, 0, 0)
+	p.FailCodes = []int{2, 3}
+	p.SuccessCodes = []int{3}
+	p.PreventRestartCodes = []int{2}
+
+	cases := []struct {
+		code    int
+		outcome string
+		restart bool
+	}{
+		{0, process.OutcomeSuccess, false},
+		{1, process.OutcomeSuccess, false},
+		{2, process.OutcomeFailure, false},
+		{3, process.OutcomeSuccess, false},
+	}
+	for _, c := range cases {
+		ev := process.ExitEvent{ExitCode: c.code}
+		if got := p.Outcome(ev); got != c.outcome {
+			t.Errorf("exit %d: expect outcome %s, got %s", c.code, c.outcome, got)
+		}
+		if got := p.ShouldRestart(ev); got != c.restart {
+			t.Errorf("exit %d: expect restart %v, got %v", c.code, c.restart, got)
+		}
+	}
+
+	p.FailCodes = nil
+	if !p.ShouldRestart(process.ExitEvent{ExitCode: 1}) {
+		t.Error("exit 1 should restart when failCodes is empty")
+	}
+	if p.Outcome(process.ExitEvent{ExitCode: -1, Signal: syscall.SIGSEGV}) != process.OutcomeSignal {
+		t.Error("SIGSEGV should be classified as signal")
+	}
+}
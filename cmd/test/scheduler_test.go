@@ -0,0 +1,148 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"wsystemd/cmd/cluster"
+)
+
+type denyFilter struct{ host string }
+
+func (f denyFilter) Name() string { return "deny" }
+
+func (f denyFilter) Filter(req *cluster.ScheduleRequest, w *cluster.Worker) error {
+	if w.Hostname == f.host {
+		return errors.New("denied")
+	}
+	return nil
+}
+
+func worker(host string, cpu, mem, load float64, tasks int) cluster.Worker {
+	return cluster.Worker{
+		Hostname: host,
+		Resources: cluster.ResourceInfo{
+			CPUUsage:    cpu,
+			MemoryUsage: mem,
+			LoadUsage:   load,
+			TaskCount:   tasks,
+		},
+	}
+}
+
+func TestWeightedScheduler(t *testing.T) {
+	var (
+		req     = &cluster.ScheduleRequest{}
+		workers = []cluster.Worker{
+			worker("node-a", 1, 99, 0.5, 3),
+			worker("node-b", 30, 30, 0.5, 3),
+		}
+	)
+
+	// 只看 cpu 时 node-a 胜出, 综合打分时内存几乎耗尽的 node-a 不应被选中
+	s := cluster.NewScheduler(&cluster.SchedulerConfig{
+		Weights: map[string]float64{"mem": 0, "load": 0, "task": 0},
+	})
+	if node, _ := s.Schedule(req, workers); node != "node-a" {
+		t.Fatalf("cpu only: got %s, want node-a", node)
+	}
+	s = cluster.NewScheduler(&cluster.SchedulerConfig{})
+	if node, _ := s.Schedule(req, workers); node != "node-b" {
+		t.Fatalf("weighted: got %s, want node-b", node)
+	}
+
+	s.Filters = append(s.Filters, denyFilter{host: "node-b"})
+	if node, _ := s.Schedule(req, workers); node != "node-a" {
+		t.Fatalf("filtered: got %s, want node-a", node)
+	}
+
+	s.Filters = append(s.Filters, denyFilter{host: "node-a"})
+	if _, err := s.Schedule(req, workers); !errors.Is(err, cluster.ErrNoAvailableWorker) {
+		t.Fatalf("all filtered: got %v, want ErrNoAvailableWorker", err)
+	}
+}
+
+func TestPlacementConstraints(t *testing.T) {
+	var (
+		s       = cluster.NewScheduler(&cluster.SchedulerConfig{})
+		workers = []cluster.Worker{
+			{Hostname: "node-a", Dc: "bj", IP: "10.0.0.1", Labels: map[string]string{"disk": "ssd"}},
+			{Hostname: "node-b", Dc: "sh", IP: "10.0.1.1", IPs: []string{"10.0.1.1", "192.168.1.1"}},
+		}
+	)
+	cases := []struct {
+		req  cluster.ScheduleRequest
+		want string
+	}{
+		{cluster.ScheduleRequest{Node: "node-b"}, "node-b"},
+		{cluster.ScheduleRequest{Dc: "bj"}, "node-a"},
+		{cluster.ScheduleRequest{Ip: "192.168.1.1"}, "node-b"},
+		{cluster.ScheduleRequest{Selector: map[string]string{"disk": "ssd"}}, "node-a"},
+		{cluster.ScheduleRequest{Selector: map[string]string{"Disk": "ssd"}}, "node-a"},
+		{cluster.ScheduleRequest{Dc: "sh", Selector: map[string]string{"disk": "ssd"}}, ""},
+		{cluster.ScheduleRequest{Node: "node-c"}, ""},
+	}
+	for _, c := range cases {
+		node, err := s.Schedule(&c.req, workers)
+		if c.want == "" {
+			if !errors.Is(err, cluster.ErrNoAvailableWorker) {
+				t.Fatalf("%+v: got %s %v, want ErrNoAvailableWorker", c.req, node, err)
+			}
+			continue
+		}
+		if err != nil || node != c.want {
+			t.Fatalf("%+v: got %s %v, want %s", c.req, node, err, c.want)
+		}
+	}
+}
+
+func TestStateFilter(t *testing.T) {
+	var (
+		s       = cluster.NewScheduler(&cluster.SchedulerConfig{})
+		req     = &cluster.ScheduleRequest{}
+		workers = []cluster.Worker{
+			{Hostname: "node-a", Status: cluster.WorkerCordoned},
+			{Hostname: "node-b", Status: cluster.WorkerDraining},
+			{Hostname: "node-c", Status: cluster.WorkerActive},
+		}
+	)
+	candidates, err := s.Filter(req, workers)
+	if err != nil || len(candidates) != 1 || candidates[0].Hostname != "node-c" {
+		t.Fatalf("got %+v %v, want only node-c", candidates, err)
+	}
+	if _, err = s.Filter(req, workers[:2]); !errors.Is(err, cluster.ErrNoAvailableWorker) {
+		t.Fatalf("got %v, want ErrNoAvailableWorker", err)
+	}
+}
+
+type fullFilter struct{ hosts map[string]bool }
+
+func (f fullFilter) Name() string { return "full" }
+
+func (f fullFilter) Filter(req *cluster.ScheduleRequest, w *cluster.Worker) error {
+	if f.hosts[w.Hostname] {
+		return fmt.Errorf("%w: task count", cluster.ErrNoCapacity)
+	}
+	return nil
+}
+
+func TestNoCapacity(t *testing.T) {
+	var (
+		req     = &cluster.ScheduleRequest{}
+		workers = []cluster.Worker{{Hostname: "node-a"}, {Hostname: "node-b"}}
+	)
+	s := cluster.NewScheduler(&cluster.SchedulerConfig{})
+	s.Filters = append([]cluster.Filter{fullFilter{hosts: map[string]bool{"node-a": true, "node-b": true}}}, s.Filters...)
+	if _, err := s.Filter(req, workers); !errors.Is(err, cluster.ErrNoCapacity) || errors.Is(err, cluster.ErrNoAvailableWorker) {
+		t.Fatalf("all full: got %v, want ErrNoCapacity", err)
+	}
+
+	// 不满足约束的节点即使资源不足也按约束失败处理
+	s.Filters = append(s.Filters, denyFilter{host: "node-b"})
+	if _, err := s.Filter(req, workers); !errors.Is(err, cluster.ErrNoAvailableWorker) {
+		t.Fatalf("full and denied: got %v, want ErrNoAvailableWorker", err)
+	}
+	if _, err := s.Filter(req, workers[:1]); !errors.Is(err, cluster.ErrNoCapacity) {
+		t.Fatalf("full: got %v, want ErrNoCapacity", err)
+	}
+}
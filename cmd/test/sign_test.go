@@ -0,0 +1,48 @@
+package test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"wsystemd/cmd/cluster"
+)
+
+func TestSignRequest(t *testing.T) {
+	var (
+		secret = "s3cret"
+		body   = []byte(`{"run":{"cmd":"/bin/true"}}`)
+	)
+	req := httptest.NewRequest("POST", "/v1/jobs/submit?x=1", nil)
+	cluster.SignRequest(req, body, "node-a", secret)
+
+	if node, err := cluster.VerifyRequest(req, body, secret, 60); err != nil || node != "node-a" {
+		t.Fatalf("verify: node=%s err=%v", node, err)
+	}
+	// 同一请求在时间窗口内再次出现
+	if _, err := cluster.VerifyRequest(req, body, secret, 60); !errors.Is(err, cluster.ErrReplayed) {
+		t.Fatalf("replay: got %v", err)
+	}
+	if _, err := cluster.VerifyRequest(req, []byte(`{"run":{"cmd":"/bin/sh"}}`), secret, 60); !errors.Is(err, cluster.ErrInvalidSignature) {
+		t.Fatalf("tampered body: got %v", err)
+	}
+	if _, err := cluster.VerifyRequest(req, body, "other", 60); !errors.Is(err, cluster.ErrInvalidSignature) {
+		t.Fatalf("wrong secret: got %v", err)
+	}
+
+	req.Header.Set(cluster.TimestampHeader, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	if _, err := cluster.VerifyRequest(req, body, secret, 60); !errors.Is(err, cluster.ErrSignatureExpired) {
+		t.Fatalf("expired: got %v", err)
+	}
+
+	unsigned := httptest.NewRequest("POST", "/v1/jobs/submit", nil)
+	unsigned.Header.Set(cluster.ForwardedHeader, "node-a")
+	if _, err := cluster.VerifyRequest(unsigned, nil, secret, 60); !errors.Is(err, cluster.ErrMissingSignature) {
+		t.Fatalf("unsigned: got %v", err)
+	}
+	// 未配置 secret 时不能仅凭转发标记信任请求
+	if _, err := cluster.VerifyRequest(unsigned, nil, "", 60); !errors.Is(err, cluster.ErrNoSecret) {
+		t.Fatalf("no secret: got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+	"wsystemd/cmd/dispatch"
+	"wsystemd/cmd/http/consts"
+	"wsystemd/cmd/http/core"
+	"wsystemd/cmd/http/dto/entity"
+	"wsystemd/cmd/http/service"
+	"wsystemd/cmd/log"
+	"wsystemd/cmd/process"
+
+	kitlog "github.com/go-kit/kit/log"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// newTestDB 内存数据库, 替代 mysql 供 service 测试使用
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{SingularTable: true},
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&entity.Task{}, &entity.TaskEvent{}, &entity.JobTimer{}, &entity.JobExecution{}); err != nil {
+		t.Fatal(err)
+	}
+	core.SetDB(core.DB_VRW, db)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newBackoffTask 创建一个退出后正在等待重启的常驻任务, restartSec 为 1 秒
+func newBackoffTask(t *testing.T, db *gorm.DB, jobId string) *entity.Task {
+	log.Logger = kitlog.NewNopLogger()
+	core.CoreConfig = map[string]interface{}{"singlemode": true}
+	process.PManager = process.NewProcManager()
+
+	hostName, err := process.GetHostName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &entity.Task{
+		JobId:   jobId,
+		Node:    hostName,
+		Pid:     1 << 22,
+		Cmd:     "/bin/sleep",
+		Args:    "30",
+		Outfile: os.DevNull,
+		Errfile: os.DevNull,
+		Spec:    `{"restart":"always","restartSec":1}`,
+		DoOnce:  consts.NotDoOnce,
+		Status:  consts.TaskStatusRunning,
+	}
+	if err = db.Create(task).Error; err != nil {
+		t.Fatal(err)
+	}
+	service.HandleJobExit(process.ExitEvent{JobId: jobId, Pid: task.Pid, ExitCode: 1, EndTime: time.Now()})
+	db.First(task, task.ID)
+	if task.Status != consts.TaskStatusRunning {
+		t.Fatalf("backoff: got status %d, want running", task.Status)
+	}
+	return task
+}
+
+func TestStopJobDuringBackoff(t *testing.T) {
+	db := newTestDB(t)
+	task := newBackoffTask(t, db, "job-backoff")
+
+	if code := service.StopJobLocal(task.JobId, false); code.Code != 0 {
+		t.Fatalf("stop: got %+v", code)
+	}
+	db.First(task, task.ID)
+	if task.Status != consts.TaskStatusStopped || task.Outcome != process.OutcomeStopped {
+		t.Fatalf("stop: got status %d outcome %q", task.Status, task.Outcome)
+	}
+
+	// 重启时间过后巡检也不会重新拉起
+	time.Sleep(1500 * time.Millisecond)
+	if err := service.CheckClientAlive(); err != nil {
+		t.Fatal(err)
+	}
+	if pid, exist := process.PManager.JobExist(task.JobId); exist {
+		process.PManager.StopProc(task.JobId, pid, true)
+		t.Fatal("stopped job restarted")
+	}
+	db.First(task, task.ID)
+	if task.Status != consts.TaskStatusStopped {
+		t.Fatalf("after check: got status %d", task.Status)
+	}
+}
+
+func TestRecoverSkipsStoppedJobs(t *testing.T) {
+	db := newTestDB(t)
+	task := newBackoffTask(t, db, "job-recover")
+	if code := service.StopJobLocal(task.JobId, false); code.Code != 0 {
+		t.Fatalf("stop: got %+v", code)
+	}
+
+	// 未配置 restart 的任务同样保持停止
+	legacy := &entity.Task{JobId: "job-legacy", Node: task.Node, Cmd: task.Cmd, Args: task.Args,
+		Outfile: os.DevNull, Errfile: os.DevNull, DoOnce: consts.NotDoOnce, Status: consts.TaskStatusStopped, Outcome: process.OutcomeSuccess}
+	if err := db.Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.RecoverJobs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobId := range []string{task.JobId, legacy.JobId} {
+		if pid, exist := process.PManager.JobExist(jobId); exist {
+			process.PManager.StopProc(jobId, pid, true)
+			t.Fatalf("%s: stopped job restarted on recover", jobId)
+		}
+	}
+}
+
+func TestTimerReplaceJobInBackoff(t *testing.T) {
+	db := newTestDB(t)
+	old := newBackoffTask(t, db, "job-replaced")
+
+	timer := &entity.JobTimer{
+		TimerId:           "timer-replace",
+		Spec:              `{"run":{"cmd":"/bin/sleep","args":["30"],"outfile":"/dev/null","errfile":"/dev/null"}}`,
+		ScheduleType:      dispatch.TypeInterval,
+		IntervalSec:       3600,
+		MissedPolicy:      dispatch.MissedSkip,
+		ConcurrencyPolicy: dispatch.ConcurrencyReplace,
+		Status:            consts.TimerActive,
+		NextRunTime:       time.Now(),
+		LastJobId:         old.JobId,
+	}
+	if err := db.Create(timer).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 触发一次, 并等待旧任务的重启时间过去
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	service.TimerLoop(ctx)
+
+	db.First(timer, timer.ID)
+	if timer.LastJobId == "" || timer.LastJobId == old.JobId {
+		t.Fatalf("replace: last job %q, error %q", timer.LastJobId, timer.LastError)
+	}
+	if pid, exist := process.PManager.JobExist(timer.LastJobId); !exist {
+		t.Fatal("replace: new job not running")
+	} else {
+		process.PManager.StopProc(timer.LastJobId, pid, true)
+	}
+	if pid, exist := process.PManager.JobExist(old.JobId); exist {
+		process.PManager.StopProc(old.JobId, pid, true)
+		t.Fatal("replace: old job restarted")
+	}
+	var count int64
+	db.Model(&entity.Task{}).Where("job_id = ?", old.JobId).Count(&count)
+	if count != 0 {
+		t.Fatalf("replace: old task row kept")
+	}
+}
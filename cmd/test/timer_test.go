@@ -0,0 +1,78 @@
+package test
+
+import (
+	"testing"
+	"time"
+	"wsystemd/cmd/dispatch"
+)
+
+func TestTimerDue(t *testing.T) {
+	var (
+		base  = time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+		every = time.Minute
+	)
+	s, err := dispatch.Parse(dispatch.TypeInterval, "", 60, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按时触发
+	plan := dispatch.Due(s, dispatch.MissedSkip, base, base.Add(time.Second), 30*time.Second)
+	if !plan.Run || !plan.FireTime.Equal(base) || !plan.Next.Equal(base.Add(every)) {
+		t.Fatalf("on time: got %+v", plan)
+	}
+
+	// 错过 10 分钟
+	now := base.Add(10*every + 10*time.Second)
+	if plan = dispatch.Due(s, dispatch.MissedSkip, base, now, 30*time.Second); plan.Run || !plan.Next.Equal(base.Add(11*every)) {
+		t.Fatalf("skip: got %+v", plan)
+	}
+	if plan = dispatch.Due(s, dispatch.MissedRunOnce, base, now, 30*time.Second); !plan.Run || !plan.Next.Equal(base.Add(11*every)) {
+		t.Fatalf("once: got %+v", plan)
+	}
+	// catchup 依次补执行, 每次只推进一个周期
+	if plan = dispatch.Due(s, dispatch.MissedCatchUp, base, now, 30*time.Second); !plan.Run || !plan.FireTime.Equal(base) || !plan.Next.Equal(base.Add(every)) {
+		t.Fatalf("catchup: got %+v", plan)
+	}
+	// 超过 MaxCatchUp 时只补最近的
+	now = base.Add(1000 * every)
+	plan = dispatch.Due(s, dispatch.MissedCatchUp, base, now, 0)
+	if want := now.Add(-(dispatch.MaxCatchUp - 1) * every); !plan.FireTime.Equal(want) {
+		t.Fatalf("catchup limit: got %s, want %s", plan.FireTime, want)
+	}
+
+	// cron 停机很久时同样只补最近的, 不遍历所有错过的触发
+	if s, err = dispatch.Parse(dispatch.TypeCron, "* * * * *", 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	now = base.AddDate(10, 0, 0)
+	plan = dispatch.Due(s, dispatch.MissedCatchUp, base, now, 0)
+	if want := now.Add(-(dispatch.MaxCatchUp - 1) * time.Minute); !plan.FireTime.Equal(want) {
+		t.Fatalf("cron catchup limit: got %s, want %s", plan.FireTime, want)
+	}
+}
+
+func TestTimerParse(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.Local)
+
+	s, err := dispatch.Parse(dispatch.TypeCron, "0 * * * *", 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := dispatch.First(s, now); !next.Equal(now.Add(30 * time.Minute)) {
+		t.Fatalf("cron: got %s", next)
+	}
+	if _, err = dispatch.Parse(dispatch.TypeCron, "* * *", 0, time.Time{}); err == nil {
+		t.Fatal("invalid cron should fail")
+	}
+
+	// 一次性定时器执行后没有下一次
+	at := now.Add(time.Hour)
+	if s, err = dispatch.Parse(dispatch.TypeOnce, "", 0, at); err != nil {
+		t.Fatal(err)
+	}
+	plan := dispatch.Due(s, dispatch.MissedSkip, at, at, 30*time.Second)
+	if !plan.Run || !plan.Next.IsZero() {
+		t.Fatalf("once: got %+v", plan)
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"wsystemd/cmd/workflow"
+)
+
+func TestWorkflowValidate(t *testing.T) {
+	steps := []workflow.Step{
+		{Name: "a"},
+		{Name: "b", DependsOn: []string{"a", "c"}},
+		{Name: "c", DependsOn: []string{"b"}},
+	}
+	if err := workflow.Validate(steps); !errors.Is(err, workflow.ErrCycle) {
+		t.Fatalf("cycle: got %v", err)
+	}
+
+	steps = []workflow.Step{{Name: "a", DependsOn: []string{"x"}}}
+	if err := workflow.Validate(steps); err == nil {
+		t.Fatal("unknown dependency: expected error")
+	}
+	steps = []workflow.Step{{Name: "a"}, {Name: "a"}}
+	if err := workflow.Validate(steps); err == nil {
+		t.Fatal("duplicate step: expected error")
+	}
+
+	steps = []workflow.Step{
+		{Name: "c", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "a"},
+	}
+	order, err := workflow.Order(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("order: got %v, want %v", order, want)
+	}
+}
+
+func TestWorkflowAdvance(t *testing.T) {
+	newSteps := func(onFailure string) []workflow.Step {
+		return []workflow.Step{
+			{Name: "a", OnFailure: onFailure},
+			{Name: "b", DependsOn: []string{"a"}},
+			{Name: "c", DependsOn: []string{"b"}},
+			{Name: "d"},
+		}
+	}
+
+	// 没有依赖的步骤同时启动
+	plan, err := workflow.Advance(newSteps(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "d"}; !reflect.DeepEqual(plan.Start, want) || plan.Done {
+		t.Fatalf("start: got %+v", plan)
+	}
+
+	// 常驻任务就绪后启动下游
+	steps := newSteps("")
+	steps[0].Status, steps[3].Status = workflow.StepReady, workflow.StepRunning
+	if plan, _ = workflow.Advance(steps); !reflect.DeepEqual(plan.Start, []string{"b"}) {
+		t.Fatalf("ready: got %+v", plan)
+	}
+
+	// fail: 取消未启动的步骤, 等待运行中的步骤结束
+	steps = newSteps(workflow.OnFailureFail)
+	steps[0].Status, steps[3].Status = workflow.StepFailed, workflow.StepRunning
+	plan, _ = workflow.Advance(steps)
+	if !plan.Failed || plan.Done || !reflect.DeepEqual(plan.Cancel, []string{"b", "c"}) {
+		t.Fatalf("fail: got %+v", plan)
+	}
+
+	// skip: 跳过传递给所有下游
+	steps = newSteps(workflow.OnFailureSkip)
+	steps[0].Status, steps[3].Status = workflow.StepFailed, workflow.StepSucceeded
+	plan, _ = workflow.Advance(steps)
+	if plan.Failed || !plan.Done || !reflect.DeepEqual(plan.Skip, []string{"b", "c"}) {
+		t.Fatalf("skip: got %+v", plan)
+	}
+
+	// continue: 下游继续执行
+	steps = newSteps(workflow.OnFailureContinue)
+	steps[0].Status = workflow.StepFailed
+	if plan, _ = workflow.Advance(steps); plan.Failed || !reflect.DeepEqual(plan.Start, []string{"d", "b"}) {
+		t.Fatalf("continue: got %+v", plan)
+	}
+}
@@ -19,6 +19,15 @@ var (
 	JobExecOutTime = &CodeType{1006, "任务执行超时"}
 
 	NoAvailableWorker = &CodeType{2001, "没有可用的 Worker"}
+	NotClusterMode    = &CodeType{2002, "非集群模式"}
+	NoLeader          = &CodeType{2003, "集群暂无 leader"}
+	WorkerTimeout     = &CodeType{2004, "节点请求超时"}
+	RpcVersionErr     = &CodeType{2005, "节点协议版本不一致"}
+	WorkerAuthErr     = &CodeType{2006, "节点间请求签名校验失败"}
+	Unauthorized      = &CodeType{2007, "未认证或凭证无效"}
+	Forbidden         = &CodeType{2008, "没有权限"}
+	ExecQueueFull     = &CodeType{2009, "执行队列已满, 请稍后重试"}
+	NoCapacity        = &CodeType{2010, "节点资源不足"}
 )
 
 type CodeType struct {
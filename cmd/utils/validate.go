@@ -72,10 +72,18 @@ func (v *ValidatorX) ParseForm(c *gin.Context, obj interface{}) string {
 	return ""
 }
 
+// Normalizer 校验前统一参数取值, 如兼容旧版本的大小写和别名
+type Normalizer interface {
+	Normalize()
+}
+
 func (v *ValidatorX) ParseJson(c *gin.Context, obj interface{}) string {
 	if err := c.ShouldBindWith(obj, binding.JSON); err != nil {
 		return "参数解析失败," + err.Error()
 	}
+	if n, ok := obj.(Normalizer); ok {
+		n.Normalize()
+	}
 	err := v.Validate.Struct(obj)
 	if err != nil {
 		return v.parseErrorHandler(err)
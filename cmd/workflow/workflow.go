@@ -0,0 +1,204 @@
+package workflow
+
+// 任务依赖编排, 类似 systemd 的 After=/Requires=: 步骤在上游全部成功(或常驻任务健康)后启动
+// 只负责校验依赖图和计算下一步动作, 任务的创建与状态持久化由 service 完成
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 步骤状态
+const (
+	StepPending   = iota // 等待上游
+	StepRunning          // 已启动, 未完成或未健康
+	StepReady            // 常驻任务已运行且健康, 下游可以启动
+	StepSucceeded        // 一次性任务执行成功
+	StepFailed
+	StepSkipped  // 上游失败被跳过
+	StepCanceled // 工作流失败或取消, 未启动的步骤不再启动
+)
+
+// 工作流状态
+const (
+	StatusRunning = iota + 1
+	StatusSucceeded
+	StatusFailed
+	StatusCanceled
+)
+
+// 步骤失败时的处理策略
+const (
+	OnFailureFail     = "fail"     // 工作流失败, 不再启动新的步骤
+	OnFailureSkip     = "skip"     // 跳过依赖该步骤的下游
+	OnFailureContinue = "continue" // 视为完成, 下游继续执行
+)
+
+var (
+	ErrEmptyWorkflow = errors.New("workflow has no steps")
+	ErrCycle         = errors.New("workflow has dependency cycle")
+)
+
+type Step struct {
+	Name      string
+	DependsOn []string
+	OnFailure string
+	Status    int
+}
+
+// Validate 校验步骤名唯一、依赖存在且无环
+func Validate(steps []Step) error {
+	_, err := Order(steps)
+	return err
+}
+
+// Order 按依赖关系排序, 上游在前; 存在环时返回 ErrCycle 及环上的步骤
+func Order(steps []Step) ([]string, error) {
+	if len(steps) == 0 {
+		return nil, ErrEmptyWorkflow
+	}
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if step.Name == "" {
+			return nil, fmt.Errorf("step %d has no name", i)
+		}
+		if _, ok := index[step.Name]; ok {
+			return nil, fmt.Errorf("duplicate step %q", step.Name)
+		}
+		index[step.Name] = i
+	}
+
+	var (
+		indegree   = make([]int, len(steps))
+		downstream = make([][]int, len(steps))
+	)
+	for i, step := range steps {
+		seen := make(map[string]bool, len(step.DependsOn))
+		for _, dep := range step.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("step %q depends on unknown step %q", step.Name, dep)
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			indegree[i]++
+			downstream[j] = append(downstream[j], i)
+		}
+	}
+
+	// Kahn 拓扑排序, 按提交顺序处理同一层的步骤
+	var (
+		order = make([]string, 0, len(steps))
+		queue []int
+	)
+	for i := range steps {
+		if indegree[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, steps[i].Name)
+		for _, j := range downstream[i] {
+			if indegree[j]--; indegree[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if len(order) < len(steps) {
+		var cycle []string
+		for i, step := range steps {
+			if indegree[i] > 0 {
+				cycle = append(cycle, step.Name)
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// Plan 一次推进的结果
+type Plan struct {
+	Start  []string
+	Skip   []string
+	Cancel []string
+	// 没有未结束的步骤时工作流结束, Failed 表示有 fail 策略的步骤失败
+	Done   bool
+	Failed bool
+}
+
+// Advance 根据各步骤当前状态计算需要启动、跳过和取消的步骤
+// 失败策略为 fail 的步骤失败后取消所有未启动的步骤, 已启动的步骤不受影响
+func Advance(steps []Step) (Plan, error) {
+	var plan Plan
+	order, err := Order(steps)
+	if err != nil {
+		return plan, err
+	}
+	byName := make(map[string]*Step, len(steps))
+	status := make(map[string]int, len(steps))
+	for i := range steps {
+		byName[steps[i].Name] = &steps[i]
+		status[steps[i].Name] = steps[i].Status
+		if steps[i].Status == StepFailed && onFailure(steps[i]) == OnFailureFail {
+			plan.Failed = true
+		}
+	}
+
+	for _, name := range order {
+		step := byName[name]
+		if status[name] != StepPending {
+			continue
+		}
+		if plan.Failed {
+			status[name] = StepCanceled
+			plan.Cancel = append(plan.Cancel, name)
+			continue
+		}
+		ready, skip := true, false
+		for _, dep := range step.DependsOn {
+			switch status[dep] {
+			case StepReady, StepSucceeded:
+			case StepFailed:
+				switch onFailure(*byName[dep]) {
+				case OnFailureContinue:
+				case OnFailureSkip:
+					skip = true
+				}
+			case StepSkipped, StepCanceled:
+				skip = true
+			default:
+				ready = false
+			}
+		}
+		switch {
+		case skip:
+			// 在拓扑序中处理, 跳过会继续传递给下游
+			status[name] = StepSkipped
+			plan.Skip = append(plan.Skip, name)
+		case ready:
+			status[name] = StepRunning
+			plan.Start = append(plan.Start, name)
+		}
+	}
+
+	plan.Done = true
+	for _, s := range status {
+		if s == StepPending || s == StepRunning {
+			plan.Done = false
+			break
+		}
+	}
+	return plan, nil
+}
+
+func onFailure(step Step) string {
+	if step.OnFailure == "" {
+		return OnFailureFail
+	}
+	return step.OnFailure
+}
@@ -5,8 +5,12 @@ DROP TABLE IF EXISTS `task`;
 CREATE TABLE `task` (
   `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
   `job_id` varchar(64) NOT NULL COMMENT '任务ID',
+  `parent_id` varchar(64) NOT NULL DEFAULT '' COMMENT '多副本任务的 service_id',
+  `replica` int(11) NOT NULL DEFAULT '0' COMMENT '副本序号',
   `node` varchar(64) NOT NULL COMMENT '节点名称',
   `pid` int(11) NOT NULL DEFAULT '0' COMMENT '进程ID',
+  `token` varchar(128) NOT NULL DEFAULT '' COMMENT '进程环境变量 TASK_TOKEN, 心跳上报凭证',
+  `proc_start_time` bigint(20) NOT NULL DEFAULT '0' COMMENT '进程启动时间(毫秒), 用于重启后校验 pid 归属',
   `cmd` varchar(255) NOT NULL COMMENT '执行命令',
   `args` text COMMENT '命令参数',
   `outfile` varchar(255) DEFAULT NULL COMMENT '标准输出文件',
@@ -18,14 +22,147 @@ CREATE TABLE `task` (
   `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '任务状态: 0-停止 1-运行中 2-失败',
   `retry_count` int(11) NOT NULL DEFAULT '0' COMMENT '重试次数',
   `last_error` text COMMENT '最后一次错误信息',
+  `outcome` varchar(32) NOT NULL DEFAULT '' COMMENT '最后一次退出结果: success/failure/signal/stopped/lost/start-failed/unhealthy',
+  `health` varchar(16) NOT NULL DEFAULT '' COMMENT '健康检查状态: 空-未知 healthy unhealthy',
+  `movable` tinyint(4) NOT NULL DEFAULT '1' COMMENT '是否允许 rebalance 迁移: 0-否 1-是',
   `heart_beat_time` datetime DEFAULT NULL COMMENT '心跳时间',
   `create_time` datetime DEFAULT NULL COMMENT '创建时间',
   `update_time` datetime DEFAULT NULL  COMMENT '更新时间',
   `big_one` varchar(255) NOT NULL DEFAULT '',
   `type` varchar(255) NOT NULL DEFAULT '',
+  `spec` text COMMENT '任务提交时的完整配置(JSON), 包含重启策略等',
   PRIMARY KEY (`id`),
   UNIQUE KEY `uk_job_id` (`job_id`),
   KEY `idx_node_pid` (`node`, `pid`),
   KEY `idx_heart_beat` (`heart_beat_time`),
+  KEY `idx_node_status` (`node`, `status`),
+  KEY `idx_parent_id` (`parent_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `job_service`;
+CREATE TABLE `job_service` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `service_id` varchar(64) NOT NULL COMMENT '服务ID, 即副本的 parent_id',
+  `spec` text COMMENT '提交时的任务配置(JSON)',
+  `replicas` int(11) NOT NULL DEFAULT '1' COMMENT '期望副本数',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  `update_time` datetime DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_service_id` (`service_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `task_event`;
+CREATE TABLE `task_event` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `job_id` varchar(64) NOT NULL COMMENT '任务ID',
+  `type` varchar(32) NOT NULL COMMENT '事件类型: failover/drain/rebalance 及对应的 -failed',
+  `from_node` varchar(255) NOT NULL DEFAULT '' COMMENT '原节点',
+  `to_node` varchar(255) NOT NULL DEFAULT '' COMMENT '目标节点',
+  `message` text COMMENT '事件说明',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_job_id` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `job_timer`;
+CREATE TABLE `job_timer` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `timer_id` varchar(64) NOT NULL COMMENT '定时器ID',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT '名称',
+  `spec` text COMMENT '触发时创建的任务配置(JSON)',
+  `schedule_type` varchar(16) NOT NULL COMMENT '定时类型: cron/interval/once',
+  `cron` varchar(255) NOT NULL DEFAULT '' COMMENT 'cron 表达式',
+  `interval_sec` int(11) NOT NULL DEFAULT '0' COMMENT '固定间隔(秒)',
+  `run_at` datetime DEFAULT NULL COMMENT '一次性定时器的执行时间',
+  `missed_policy` varchar(16) NOT NULL DEFAULT 'skip' COMMENT '错过触发的处理: skip/once/catchup',
+  `concurrency_policy` varchar(16) NOT NULL DEFAULT 'forbid' COMMENT '上次任务未结束时的处理: allow/forbid/replace',
+  `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '状态: 0-暂停 1-运行中 2-已结束',
+  `version` bigint(20) NOT NULL DEFAULT '0' COMMENT '每次触发或修改递增, 用于抢占触发',
+  `next_run_time` datetime NOT NULL COMMENT '下一次触发时间',
+  `last_run_time` datetime DEFAULT NULL COMMENT '上一次触发时间',
+  `last_job_id` varchar(64) NOT NULL DEFAULT '' COMMENT '上一次创建的任务ID',
+  `last_error` text COMMENT '上一次触发的错误信息',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  `update_time` datetime DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_timer_id` (`timer_id`),
+  KEY `idx_status_next` (`status`, `next_run_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `job_execution`;
+CREATE TABLE `job_execution` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `exec_id` varchar(64) NOT NULL COMMENT '执行ID',
+  `node` varchar(255) NOT NULL DEFAULT '' COMMENT '执行节点',
+  `cmd` varchar(1024) NOT NULL DEFAULT '' COMMENT '命令',
+  `args` text COMMENT '参数',
+  `spec` text COMMENT '提交时的任务配置(JSON)',
+  `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '状态: 0-排队 1-执行中 2-成功 3-失败',
+  `outcome` varchar(32) NOT NULL DEFAULT '' COMMENT '执行结果: success/failure/signal/lost/start-failed',
+  `exit_code` int(11) NOT NULL DEFAULT '0' COMMENT '退出码',
+  `duration_ms` bigint(20) NOT NULL DEFAULT '0' COMMENT '执行耗时(毫秒)',
+  `stdout` mediumtext COMMENT '标准输出, 超过 outputLimit 时只保留末尾',
+  `stderr` mediumtext COMMENT '标准错误, 超过 outputLimit 时只保留末尾',
+  `truncated` tinyint(1) NOT NULL DEFAULT '0' COMMENT '输出是否被截断',
+  `last_error` text COMMENT '错误信息',
+  `start_time` datetime DEFAULT NULL COMMENT '开始执行时间',
+  `end_time` datetime DEFAULT NULL COMMENT '结束时间',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  `update_time` datetime DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_exec_id` (`exec_id`),
   KEY `idx_node_status` (`node`, `status`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `workflow`;
+CREATE TABLE `workflow` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `workflow_id` varchar(64) NOT NULL COMMENT '工作流ID',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT '名称',
+  `status` tinyint(4) NOT NULL DEFAULT '1' COMMENT '状态: 1-运行中 2-成功 3-失败 4-已取消',
+  `last_error` text COMMENT '错误信息',
+  `end_time` datetime DEFAULT NULL COMMENT '结束时间',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  `update_time` datetime DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_workflow_id` (`workflow_id`),
+  KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `workflow_step`;
+CREATE TABLE `workflow_step` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `workflow_id` varchar(64) NOT NULL COMMENT '工作流ID',
+  `name` varchar(64) NOT NULL COMMENT '步骤名称, 工作流内唯一',
+  `depends_on` text COMMENT '上游步骤名称(JSON 数组)',
+  `on_failure` varchar(16) NOT NULL DEFAULT 'fail' COMMENT '失败处理: fail/skip/continue',
+  `spec` text COMMENT '任务配置(JSON)',
+  `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '状态: 0-等待 1-运行中 2-已就绪 3-成功 4-失败 5-跳过 6-已取消',
+  `job_id` varchar(64) NOT NULL DEFAULT '' COMMENT '创建的任务ID, doOnce 为执行ID',
+  `last_error` text COMMENT '错误信息',
+  `start_time` datetime DEFAULT NULL COMMENT '启动时间',
+  `end_time` datetime DEFAULT NULL COMMENT '结束时间',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  `update_time` datetime DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_workflow_name` (`workflow_id`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `pending_job`;
+CREATE TABLE `pending_job` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `pending_id` varchar(64) NOT NULL COMMENT '待提交任务ID',
+  `spec` text COMMENT '任务配置(JSON)',
+  `priority` tinyint(4) NOT NULL DEFAULT '1' COMMENT '优先级: 0-low 1-normal 2-high',
+  `reason` varchar(16) NOT NULL DEFAULT '' COMMENT '等待原因: delayed/capacity',
+  `status` tinyint(4) NOT NULL DEFAULT '0' COMMENT '状态: 0-等待 1-提交中 2-已提交 3-失败 4-已取消',
+  `submit_at` datetime NOT NULL COMMENT '最早提交时间',
+  `attempts` int(11) NOT NULL DEFAULT '0' COMMENT '尝试提交次数',
+  `job_id` varchar(64) NOT NULL DEFAULT '' COMMENT '提交后的任务ID',
+  `last_error` text COMMENT '上一次提交的错误信息',
+  `create_time` datetime DEFAULT NULL COMMENT '创建时间',
+  `update_time` datetime DEFAULT NULL COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_pending_id` (`pending_id`),
+  KEY `idx_status_priority` (`status`, `priority`, `submit_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;